@@ -0,0 +1,213 @@
+package background
+
+import (
+	"image"
+	"math"
+
+	"github.com/simonmarton/common-colors/color"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/sampler"
+)
+
+const defaultTolerance float64 = 30
+
+// The dominant color has to cover at least this much of the frame to be treated as background
+const minFrameShare float64 = .4
+
+// Detection runs on a downscaled grid of at most this many cells, so the memory and time
+// it takes don't grow with the size of the image
+const gridBudget int = 128 * 128
+
+// Mask weights the detected background pixels of an image
+type Mask struct {
+	bounds image.Rectangle
+	// step x step pixels of the image make up one cell of the width x height grid
+	step          int
+	width, height int
+	background    []bool
+	weight        float64
+	// Color of the detected background
+	Color color.Color
+}
+
+// Detect finds the background of an image based on the color dominating its outer frame,
+// nil is returned if background removal is turned off or the image doesn't seem to have a flat background.
+// With floodfill only the area connected to the frame is background, with frame every similar pixel is.
+func Detect(img image.Image, c models.CalculatorConfig) *Mask {
+	if c.BackgroundRemoval != "floodfill" && c.BackgroundRemoval != "frame" {
+		return nil
+	}
+
+	if c.BackgroundTolerance <= 0 {
+		c.BackgroundTolerance = defaultTolerance
+	}
+
+	if c.BackgroundWeight < 0 || c.BackgroundWeight > 1 {
+		c.BackgroundWeight = 0
+	}
+
+	b := img.Bounds()
+	if b.Empty() {
+		return nil
+	}
+
+	// Work on a coarse grid, the color of a cell is the pixel in its middle
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > gridBudget {
+		step++
+	}
+	width, height := max(1, b.Dx()/step), max(1, b.Dy()/step)
+
+	cells := make([]color.Color, width*height)
+	for cx := 0; cx < width; cx++ {
+		for cy := 0; cy < height; cy++ {
+			cells[cy*width+cx] = color.NewFromRGBA(img.At(b.Min.X+cx*step+step/2, b.Min.Y+cy*step+step/2))
+		}
+	}
+
+	frame := frameIndexes(width, height)
+	bg, ok := frameColor(cells, frame, c.BackgroundTolerance)
+	if !ok {
+		return nil
+	}
+
+	m := &Mask{
+		bounds:     b,
+		step:       step,
+		width:      width,
+		height:     height,
+		background: make([]bool, len(cells)),
+		weight:     c.BackgroundWeight,
+		Color:      bg,
+	}
+
+	if c.BackgroundRemoval == "frame" {
+		for i, p := range cells {
+			m.background[i] = similar(p, bg, c.BackgroundTolerance)
+		}
+
+		return m
+	}
+
+	// Flood fill from the matching frame cells
+	queue := []int{}
+	for _, i := range frame {
+		if !m.background[i] && similar(cells[i], bg, c.BackgroundTolerance) {
+			m.background[i] = true
+			queue = append(queue, i)
+		}
+	}
+
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		x, y := i%width, i/width
+
+		for _, n := range [][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n[0] < 0 || n[1] < 0 || n[0] >= width || n[1] >= height {
+				continue
+			}
+
+			j := n[1]*width + n[0]
+			if !m.background[j] && similar(cells[j], bg, c.BackgroundTolerance) {
+				m.background[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	return m
+}
+
+// Bounds ...
+func (m *Mask) Bounds() image.Rectangle {
+	return m.bounds
+}
+
+// Coverage is the configured background weight for background pixels and 1 for the rest
+func (m *Mask) Coverage(x, y int) float64 {
+	if !image.Pt(x, y).In(m.bounds) {
+		return 0
+	}
+
+	// The pixels past the last full cell belong to it
+	cx := min((x-m.bounds.Min.X)/m.step, m.width-1)
+	cy := min((y-m.bounds.Min.Y)/m.step, m.height-1)
+	if m.background[cy*m.width+cx] {
+		return m.weight
+	}
+
+	return 1
+}
+
+// Share of the image covered by the background, 0-1, measured on the grid
+func (m *Mask) Share() float64 {
+	n := 0
+	for _, bg := range m.background {
+		if bg {
+			n++
+		}
+	}
+
+	return float64(n) / float64(len(m.background))
+}
+
+var _ sampler.Mask = (*Mask)(nil)
+
+// frameIndexes of the outermost cells of a width x height grid
+func frameIndexes(width, height int) (result []int) {
+	for x := 0; x < width; x++ {
+		result = append(result, x)
+		if height > 1 {
+			result = append(result, (height-1)*width+x)
+		}
+	}
+
+	for y := 1; y < height-1; y++ {
+		result = append(result, y*width)
+		if width > 1 {
+			result = append(result, y*width+width-1)
+		}
+	}
+
+	return result
+}
+
+// frameColor groups the frame cells into coarse buckets and averages the biggest one,
+// false is returned if it doesn't cover enough of the frame
+func frameColor(cells []color.Color, frame []int, tolerance float64) (color.Color, bool) {
+	buckets := map[[4]uint8][]color.Color{}
+	var largest [4]uint8
+
+	for _, i := range frame {
+		p := cells[i]
+		key := [4]uint8{p.R >> 3, p.G >> 3, p.B >> 3, p.A >> 3}
+		buckets[key] = append(buckets[key], p)
+
+		if len(buckets[key]) > len(buckets[largest]) {
+			largest = key
+		}
+	}
+
+	bg := color.Average(buckets[largest])
+
+	matching := 0
+	for _, i := range frame {
+		if similar(cells[i], bg, tolerance) {
+			matching++
+		}
+	}
+
+	return bg, float64(matching)/float64(len(frame)) >= minFrameShare
+}
+
+// similar compares premultiplied values, so every transparent pixel is similar to each other
+func similar(c1, c2 color.Color, tolerance float64) bool {
+	a1, a2 := float64(c1.A)/255, float64(c2.A)/255
+	dr := float64(c1.R)*a1 - float64(c2.R)*a2
+	dg := float64(c1.G)*a1 - float64(c2.G)*a2
+	db := float64(c1.B)*a1 - float64(c2.B)*a2
+	da := float64(c1.A) - float64(c2.A)
+
+	return math.Sqrt(dr*dr+dg*dg+db*db+da*da) < tolerance
+}
@@ -0,0 +1,142 @@
+package background
+
+import (
+	"image"
+	imagecolor "image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/simonmarton/common-colors/models"
+)
+
+// ringImage is white with a red ring in the middle, the inside of the ring is white too
+func ringImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 20; y++ {
+			c := imagecolor.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			if x >= 5 && x < 15 && y >= 5 && y < 15 && !(x >= 8 && x < 12 && y >= 8 && y < 12) {
+				c = imagecolor.NRGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestDetectDisabled(t *testing.T) {
+	if Detect(ringImage(), models.CalculatorConfig{}) != nil {
+		t.Errorf("Expected no background without background removal")
+	}
+}
+
+func TestDetectFloodFill(t *testing.T) {
+	m := Detect(ringImage(), models.CalculatorConfig{BackgroundRemoval: "floodfill"})
+	if m == nil {
+		t.Fatalf("Expected background to be detected")
+	}
+
+	if m.Color.R != 255 || m.Color.G != 255 || m.Color.B != 255 {
+		t.Errorf("Expected white background, got %v", m.Color)
+	}
+
+	if m.Coverage(0, 0) != 0 {
+		t.Errorf("Expected corner to be background")
+	}
+
+	if m.Coverage(6, 6) != 1 || m.Coverage(10, 10) != 1 {
+		t.Errorf("Expected ring and its inside to be foreground")
+	}
+
+	expectedShare := 1 - 100./400
+	if m.Share() != expectedShare {
+		t.Errorf("Expected background share %.4f, got %.4f", expectedShare, m.Share())
+	}
+}
+
+func TestDetectFrame(t *testing.T) {
+	m := Detect(ringImage(), models.CalculatorConfig{BackgroundRemoval: "frame", BackgroundWeight: .1})
+	if m == nil {
+		t.Fatalf("Expected background to be detected")
+	}
+
+	if m.Coverage(10, 10) != .1 {
+		t.Errorf("Expected inside of the ring to be down-weighted background, got %.4f", m.Coverage(10, 10))
+	}
+
+	if m.Coverage(6, 6) != 1 {
+		t.Errorf("Expected ring to be foreground")
+	}
+}
+
+func TestDetectNoFlatBackground(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for x := 0; x < 10; x++ {
+		for y := 0; y < 10; y++ {
+			img.Set(x, y, imagecolor.NRGBA{R: uint8(x * 25), G: uint8(y * 25), B: 0, A: 255})
+		}
+	}
+
+	if Detect(img, models.CalculatorConfig{BackgroundRemoval: "floodfill"}) != nil {
+		t.Errorf("Expected no background for a gradient")
+	}
+}
+
+func TestDetectIcon(t *testing.T) {
+	f, err := os.Open("../test-images/facebook.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := Detect(img, models.CalculatorConfig{BackgroundRemoval: "floodfill"})
+	if m == nil {
+		t.Fatalf("Expected background to be detected")
+	}
+
+	if m.Color.B <= m.Color.R || m.Color.B <= m.Color.G {
+		t.Errorf("Expected blue background, got %v", m.Color)
+	}
+
+	// Middle of the white logo
+	if m.Coverage(256, 256) != 1 {
+		t.Errorf("Expected logo to be foreground")
+	}
+}
+
+func TestDetectLargeImage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2000, 1500))
+	for x := 0; x < 2000; x++ {
+		for y := 0; y < 1500; y++ {
+			c := imagecolor.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			if x >= 500 && x < 1500 && y >= 500 && y < 1000 {
+				c = imagecolor.NRGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	m := Detect(img, models.CalculatorConfig{BackgroundRemoval: "floodfill"})
+	if m == nil {
+		t.Fatalf("Expected background to be detected")
+	}
+
+	if len(m.background) > gridBudget {
+		t.Errorf("Expected at most %d cells, got %d", gridBudget, len(m.background))
+	}
+
+	if m.Coverage(10, 10) != 0 || m.Coverage(1999, 1499) != 0 {
+		t.Errorf("Expected corners to be background")
+	}
+
+	if m.Coverage(1000, 750) != 1 {
+		t.Errorf("Expected the square to be foreground")
+	}
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache stores values by key, implementations are safe for concurrent use
+type Cache interface {
+	// Get returns false if the key is missing or expired
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// Memory is an LRU cache limited by the total size of its values
+type Memory struct {
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	created time.Time
+}
+
+// NewMemory creates an in-memory cache, a maxBytes or ttl of 0 means no limit
+func NewMemory(maxBytes int64, ttl time.Duration) *Memory {
+	return &Memory{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+// Get ...
+func (m *Memory) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*memoryEntry)
+	if m.ttl > 0 && m.now().Sub(e.created) > m.ttl {
+		m.remove(el)
+		return nil, false
+	}
+
+	m.order.MoveToFront(el)
+
+	return e.value, true
+}
+
+// Set ...
+func (m *Memory) Set(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+
+	// Would evict everything else and still not fit
+	if m.maxBytes > 0 && int64(len(value)) > m.maxBytes {
+		return
+	}
+
+	m.items[key] = m.order.PushFront(&memoryEntry{key: key, value: value, created: m.now()})
+	m.size += int64(len(value))
+
+	for m.maxBytes > 0 && m.size > m.maxBytes {
+		m.remove(m.order.Back())
+	}
+}
+
+// Len is the number of stored values
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len()
+}
+
+func (m *Memory) remove(el *list.Element) {
+	e := m.order.Remove(el).(*memoryEntry)
+	delete(m.items, e.key)
+	m.size -= int64(len(e.value))
+}
+
+type tiered []Cache
+
+// Tiered checks the caches in order, a value found in a later one is copied into the earlier ones,
+// values are written into every cache
+func Tiered(caches ...Cache) Cache {
+	return tiered(caches)
+}
+
+func (t tiered) Get(key string) ([]byte, bool) {
+	for i, c := range t {
+		if value, ok := c.Get(key); ok {
+			for _, earlier := range t[:i] {
+				earlier.Set(key, value)
+			}
+
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+func (t tiered) Set(key string, value []byte) {
+	for _, c := range t {
+		c.Set(key, value)
+	}
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryLRU(t *testing.T) {
+	m := NewMemory(10, 0)
+	m.Set("a", []byte("1234"))
+	m.Set("b", []byte("1234"))
+
+	// a becomes the most recently used
+	if _, ok := m.Get("a"); !ok {
+		t.Fatalf("Expected a to be cached")
+	}
+
+	m.Set("c", []byte("1234"))
+
+	if _, ok := m.Get("b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+
+	if v, ok := m.Get("a"); !ok || string(v) != "1234" {
+		t.Errorf("Expected a to be kept")
+	}
+
+	if m.Len() != 2 {
+		t.Errorf("Expected 2 values, got %d", m.Len())
+	}
+
+	m.Set("d", []byte("too large value"))
+	if _, ok := m.Get("d"); ok || m.Len() != 2 {
+		t.Errorf("Expected values over the limit to be skipped")
+	}
+}
+
+func TestMemoryTTL(t *testing.T) {
+	now := time.Now()
+	m := NewMemory(0, time.Minute)
+	m.now = func() time.Time { return now }
+
+	m.Set("a", []byte("1"))
+	now = now.Add(2 * time.Minute)
+
+	if _, ok := m.Get("a"); ok {
+		t.Errorf("Expected a to be expired")
+	}
+
+	if m.Len() != 0 {
+		t.Errorf("Expected expired value to be removed")
+	}
+}
+
+func TestDisk(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	d, err := NewDisk(dir, 30, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.now = func() time.Time { return now }
+
+	d.Set("a", []byte("1234"))
+	now = now.Add(time.Second)
+	d.Set("b", []byte("1234"))
+	now = now.Add(time.Second)
+
+	// a becomes the most recently used
+	if v, ok := d.Get("a"); !ok || string(v) != "1234" {
+		t.Fatalf("Expected a to be cached")
+	}
+	now = now.Add(time.Second)
+
+	// 12 bytes per file with the header
+	d.Set("c", []byte("1234"))
+
+	if _, ok := d.Get("b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+
+	// Values survive a restart
+	d2, err := NewDisk(dir, 30, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2.now = func() time.Time { return now }
+
+	if _, ok := d2.Get("a"); !ok {
+		t.Errorf("Expected a to be persisted")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, ok := d2.Get("c"); ok {
+		t.Errorf("Expected c to be expired")
+	}
+}
+
+func TestTiered(t *testing.T) {
+	fast, slow := NewMemory(0, 0), NewMemory(0, 0)
+	c := Tiered(fast, slow)
+
+	slow.Set("a", []byte("1"))
+	if v, ok := c.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("Expected a from the slow tier")
+	}
+
+	if _, ok := fast.Get("a"); !ok {
+		t.Errorf("Expected a to be copied into the fast tier")
+	}
+
+	c.Set("b", []byte("2"))
+	if fast.Len() != 2 || slow.Len() != 2 {
+		t.Errorf("Expected b in both tiers")
+	}
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Disk stores every value in a file of a directory, the least recently used files
+// are removed once the directory grows over the size limit.
+// Files start with their creation time for the TTL, their modification time is the last access.
+type Disk struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewDisk creates a cache in dir, a maxBytes or ttl of 0 means no limit
+func NewDisk(dir string, maxBytes int64, ttl time.Duration) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Disk{dir: dir, maxBytes: maxBytes, ttl: ttl, now: time.Now}, nil
+}
+
+func (d *Disk) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get ...
+func (d *Disk) Get(key string) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p := d.path(key)
+	data, err := os.ReadFile(p)
+	if err != nil || len(data) < 8 {
+		return nil, false
+	}
+
+	created := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+	if d.ttl > 0 && d.now().Sub(created) > d.ttl {
+		os.Remove(p)
+		return nil, false
+	}
+
+	now := d.now()
+	os.Chtimes(p, now, now)
+
+	return data[8:], true
+}
+
+// Set ...
+func (d *Disk) Set(key string, value []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.maxBytes > 0 && int64(len(value)) > d.maxBytes {
+		return
+	}
+
+	// Write to a temp file first so readers never see a partial value
+	tmp, err := os.CreateTemp(d.dir, ".tmp-")
+	if err != nil {
+		return
+	}
+
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(d.now().UnixNano()))
+
+	_, err = tmp.Write(append(header[:], value...))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	p := d.path(key)
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	now := d.now()
+	os.Chtimes(p, now, now)
+
+	d.evict()
+}
+
+// evict removes the least recently used files until the directory fits into maxBytes
+func (d *Disk) evict() {
+	if d.maxBytes <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return
+	}
+
+	type file struct {
+		path     string
+		size     int64
+		accessed time.Time
+	}
+
+	var files []file
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		p := filepath.Join(d.dir, e.Name())
+		files = append(files, file{path: p, size: info.Size(), accessed: info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].accessed.Before(files[j].accessed) })
+
+	for _, f := range files {
+		if total <= d.maxBytes {
+			break
+		}
+
+		if os.Remove(f.path) == nil {
+			total -= f.size
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package calculator
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"math"
 
 	"github.com/simonmarton/common-colors/color"
+	"github.com/simonmarton/common-colors/logging"
 	"github.com/simonmarton/common-colors/models"
 )
 
@@ -16,9 +19,14 @@ const defaultDistanceThreshold float64 = 50
 const defaultMinSaturation float64 = .3
 const defaultAlgorithm string = "simple"
 
+// ErrUnsupportedAlgorithm is returned by the clustering for an Algorithm other than simple or yiq
+var ErrUnsupportedAlgorithm = errors.New("Not supported Algorithm")
+
 // Calculator can group common colors
 type Calculator struct {
-	config models.CalculatorConfig
+	config     models.CalculatorConfig
+	background *color.Color
+	logger     *slog.Logger
 }
 
 // New Calculator instance
@@ -54,34 +62,81 @@ func New(c models.CalculatorConfig) *Calculator {
 		c.Algorithm = defaultAlgorithm
 	}
 
-	return &Calculator{config: c}
+	var background *color.Color
+	if c.Background != "" {
+		bg, err := color.NewFromHex(c.Background)
+		if err != nil {
+			c.Background = ""
+		} else {
+			background = &bg
+		}
+	}
+
+	return &Calculator{config: c, background: background, logger: logging.Discard}
+}
+
+// WithLogger returns a copy of the calculator which logs its progress at debug level
+func (c Calculator) WithLogger(logger *slog.Logger) *Calculator {
+	c.logger = logging.Or(logger)
+	return &c
+}
+
+// Config with the defaults applied
+func (c Calculator) Config() models.CalculatorConfig {
+	return c.config
 }
 
-// GetCommonColors ...
-func (c Calculator) GetCommonColors(colors []color.Color) ([]color.Color, [][]color.Color) {
-	fmt.Printf("Colors length: %d\n", len(colors))
+// GetCommonColors filters and clusters the colors, steps contain the original colors,
+// the filtered ones and the result of every clustering iteration
+func (c Calculator) GetCommonColors(colors []color.Color) ([]color.Color, [][]color.Color, error) {
 	stepsOfColors := [][]color.Color{colors}
+	count := len(colors)
 
-	colors = c.removeInvalidColors(colors)
-	fmt.Printf("Colors length after: %d\n", len(colors))
+	colors = c.RemoveInvalidColors(colors)
+	logging.Or(c.logger).Debug("Filtered colors", "count", count, "remaining", len(colors))
 
 	stepsOfColors = append(stepsOfColors, colors)
 
+	colors, steps, err := c.Cluster(colors)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return colors, append(stepsOfColors, steps...), nil
+}
+
+// Cluster groups similar colors with a growing distance threshold in every iteration,
+// the result is sorted by weight
+func (c Calculator) Cluster(colors []color.Color) ([]color.Color, [][]color.Color, error) {
+	var stepsOfColors [][]color.Color
+
+	colors, err := c.ClusterSteps(colors, func(step []color.Color) {
+		stepsOfColors = append(stepsOfColors, step)
+	})
+
+	return colors, stepsOfColors, err
+}
+
+// ClusterSteps is Cluster calling onStep with the colors of every iteration as soon as it's done
+func (c Calculator) ClusterSteps(colors []color.Color, onStep func([]color.Color)) ([]color.Color, error) {
 	for i := int8(0); i < c.config.IterationCount; i++ {
 		threshold := c.config.DistanceThreshold*float64(i)/float64(c.config.IterationCount-1) + 10
-		colors = c.groupByThreshold(colors, threshold)
 
-		stepsOfColors = append(stepsOfColors, color.Sort(colors))
-	}
+		var err error
+		colors, err = c.groupByThreshold(colors, threshold)
+		if err != nil {
+			return nil, err
+		}
 
-	color.Sort(colors)
+		onStep(color.Sort(colors))
+	}
 
-	return colors, stepsOfColors
+	return color.Sort(colors), nil
 }
 
 // GenrateGradientColors ...
 func (c Calculator) GenrateGradientColors(colors []color.Color) (result []string) {
-	totalWeight := 0
+	totalWeight := 0.
 
 	for _, col := range colors {
 		totalWeight += col.Weight
@@ -91,9 +146,9 @@ func (c Calculator) GenrateGradientColors(colors []color.Color) (result []string
 	var secondaryColor string
 
 	if len(colors) >= 2 {
-		mp := float64(mainColor.Weight) / float64(totalWeight)
+		mp := mainColor.Weight / totalWeight
 		for _, col := range colors[1:] {
-			p := float64(col.Weight) / float64(totalWeight)
+			p := col.Weight / totalWeight
 
 			// Too big weight diff compared to the main color, ignore
 			// if mp-p > .4 {
@@ -125,13 +180,26 @@ func (c Calculator) GenrateGradientColors(colors []color.Color) (result []string
 	return []string{mainColor.ToHex(), secondaryColor}
 }
 
-func (c Calculator) removeInvalidColors(colors []color.Color) (result []color.Color) {
+// RemoveInvalidColors drops the transparent colors and the ones outside the configured luminance
+// and saturation ranges
+func (c Calculator) RemoveInvalidColors(colors []color.Color) (result []color.Color) {
 	for _, col := range colors {
+		if c.background != nil {
+			col = col.Composite(*c.background)
+		}
+
+		// Weight by opacity instead of a hard cutoff, fully transparent pixels still drop out
+		transparent := col.A <= c.config.TransparencyTreshold
+		if c.config.AlphaWeighted {
+			col.Weight *= float64(col.A) / 255
+			transparent = col.Weight == 0
+		}
+
 		l := col.Luminance()
 		s := col.Saturation()
 
 		// todo
-		if col.A <= c.config.TransparencyTreshold ||
+		if transparent ||
 			l < c.config.MinLuminance ||
 			l > c.config.MaxLuminance ||
 			s < c.config.MinSaturation {
@@ -144,7 +212,17 @@ func (c Calculator) removeInvalidColors(colors []color.Color) (result []color.Co
 	return result
 }
 
-func (c Calculator) groupByThreshold(colors []color.Color, threshold float64) (result []color.Color) {
+func (c Calculator) groupByThreshold(colors []color.Color, threshold float64) (result []color.Color, err error) {
+	var distance func(c1, c2 color.Color) float64
+	switch c.config.Algorithm {
+	case "simple":
+		distance = color.Color.Distance
+	case "yiq":
+		distance = color.Color.YIQDistance
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, c.config.Algorithm)
+	}
+
 	for len(colors) > 1 {
 		sample := colors[0]
 
@@ -152,17 +230,7 @@ func (c Calculator) groupByThreshold(colors []color.Color, threshold float64) (r
 		remainingColors := []color.Color{}
 
 		for _, color := range colors[1:] {
-			var d float64
-			switch c.config.Algorithm {
-			case "simple":
-				d = sample.Distance(color)
-			case "yiq":
-				d = sample.YIQDistance(color)
-			default:
-				panic("Not supported Algorithm")
-			}
-
-			if d < threshold {
+			if d := distance(sample, color); d < threshold {
 				similarColors = append(similarColors, color)
 			} else {
 				remainingColors = append(remainingColors, color)
@@ -177,7 +245,7 @@ func (c Calculator) groupByThreshold(colors []color.Color, threshold float64) (r
 	// TODO? colors at this point can still have some very different colors
 	// should we append them too?
 	// meh, why not?
-	return append(result, colors...)
+	return append(result, colors...), nil
 }
 
 // Nope
@@ -1,9 +1,15 @@
 package calculator
 
-import "testing"
+import (
+	"errors"
+	"testing"
+
+	"github.com/simonmarton/common-colors/color"
+	"github.com/simonmarton/common-colors/models"
+)
 
 func TestNewWithDefaults(t *testing.T) {
-	calc := New(Config{})
+	calc := New(models.CalculatorConfig{})
 
 	if calc.config.IterationCount != defaultIterationCount {
 		t.Errorf("Expected default iteration count %d, got %d", defaultIterationCount, calc.config.IterationCount)
@@ -15,10 +21,60 @@ func TestNewWithDefaults(t *testing.T) {
 }
 
 func TestNew(t *testing.T) {
-	config := Config{TransparencyTreshold: 123, IterationCount: 1, MinLuminance: 15, MaxLuminance: 200}
+	config := models.CalculatorConfig{TransparencyTreshold: 123, IterationCount: 1, MinLuminance: 15, MaxLuminance: 200}
 	calc := New(config)
 
-	if calc.config != config {
-		t.Errorf("Calculator config did not match")
+	// The fields which aren't set or are out of range get their defaults
+	expected := config
+	expected.MaxLuminance = defaultMaxLuminance
+	expected.DistanceThreshold = defaultDistanceThreshold
+	expected.Algorithm = defaultAlgorithm
+
+	if calc.config != expected {
+		t.Errorf("Calculator config did not match, expected %+v, got %+v", expected, calc.config)
+	}
+}
+
+func TestRemoveInvalidColorsAlphaWeighted(t *testing.T) {
+	calc := New(models.CalculatorConfig{AlphaWeighted: true, MinSaturation: 0})
+	colors := []color.Color{
+		{R: 255, A: 255, Weight: 1},
+		{R: 255, A: 51, Weight: 1},
+		{R: 255, A: 0, Weight: 1},
+	}
+
+	got := calc.RemoveInvalidColors(colors)
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 colors, got %d", len(got))
+	}
+
+	if got[1].Weight != .2 {
+		t.Errorf("Expected weight .2 for a semi-transparent color, got %.4f", got[1].Weight)
+	}
+}
+
+func TestRemoveInvalidColorsBackground(t *testing.T) {
+	calc := New(models.CalculatorConfig{Background: "#ffffff", MinSaturation: 0})
+	colors := []color.Color{
+		{R: 255, A: 0, Weight: 1},
+	}
+
+	got := calc.RemoveInvalidColors(colors)
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 color, got %d", len(got))
+	}
+
+	expected := color.Color{R: 255, G: 255, B: 255, A: 255, Weight: 1}
+	if got[0] != expected {
+		t.Errorf("Expected %v, got %v", expected, got[0])
+	}
+}
+
+func TestClusterUnsupportedAlgorithm(t *testing.T) {
+	calc := New(models.CalculatorConfig{Algorithm: "nope"})
+	colors := []color.Color{{R: 255, A: 255, Weight: 1}, {G: 255, A: 255, Weight: 1}}
+
+	if _, _, err := calc.Cluster(colors); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("Expected ErrUnsupportedAlgorithm, got %v", err)
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"image/color"
 	"math"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 // Color ...
@@ -13,13 +15,39 @@ type Color struct {
 	G      uint8
 	B      uint8
 	A      uint8
-	Weight int
+	Weight float64
 }
 
-// NewFromRGBA converts a built in Color struct
+// NewFromRGBA converts a built in Color struct, the RGB values are un-premultiplied
+// so semi-transparent pixels keep their original hue and brightness
 func NewFromRGBA(c color.Color) Color {
-	rgba := color.RGBAModel.Convert(c).(color.RGBA)
-	return Color{rgba.R, rgba.G, rgba.B, rgba.A, 1}
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return Color{nrgba.R, nrgba.G, nrgba.B, nrgba.A, 1}
+}
+
+// NewFromHex parses a #rgb or #rrggbb color string
+func NewFromHex(hex string) (Color, error) {
+	s := strings.TrimPrefix(hex, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+
+	if len(s) != 6 {
+		return Color{}, fmt.Errorf("Invalid hex color: %s", hex)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("Invalid hex color: %s", hex)
+	}
+
+	return Color{
+		R:      uint8(v >> 16),
+		G:      uint8(v >> 8),
+		B:      uint8(v),
+		A:      255,
+		Weight: 1,
+	}, nil
 }
 
 func hue2RGB(p, q, t float64) float64 {
@@ -143,33 +171,84 @@ func (c Color) ToHSLA() (h, s, l, a float64) {
 	return h / 6, s, l, a
 }
 
+// ToLab converts to the CIELAB color space with a D65 white point,
+// l is 0-100, a and b are roughly between -128 and 127
+func (c Color) ToLab() (l, a, b float64) {
+	r := linearize(c.R)
+	g := linearize(c.G)
+	bl := linearize(c.B)
+
+	x := (r*0.4124564 + g*0.3575761 + bl*0.1804375) / 0.95047
+	y := r*0.2126729 + g*0.7151522 + bl*0.0721750
+	z := (r*0.0193339 + g*0.1191920 + bl*0.9503041) / 1.08883
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// linearize removes the sRGB gamma
+func linearize(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	if t > 216/24389. {
+		return math.Cbrt(t)
+	}
+
+	return (24389/27.*t + 16) / 116
+}
+
 // Hue degree 0-1
 func (c Color) Hue() float64 {
 	h, _, _, _ := c.ToHSLA()
 	return h
 }
 
+// Composite blends the color onto an opaque background using its alpha,
+// the result is fully opaque and keeps the original weight
+func (c Color) Composite(bg Color) Color {
+	a := float64(c.A) / 255
+	blend := func(fg, bg uint8) uint8 {
+		return uint8(math.Round(float64(fg)*a + float64(bg)*(1-a)))
+	}
+
+	return Color{
+		R:      blend(c.R, bg.R),
+		G:      blend(c.G, bg.G),
+		B:      blend(c.B, bg.B),
+		A:      255,
+		Weight: c.Weight,
+	}
+}
+
 // Average of two colors
 func (c Color) Average(c2 Color) Color {
 	sumWeight := c.Weight + c2.Weight
 	return Color{
-		R:      uint8((int(c.R)*c.Weight + int(c2.R)*c2.Weight) / sumWeight),
-		G:      uint8((int(c.G)*c.Weight + int(c2.G)*c2.Weight) / sumWeight),
-		B:      uint8((int(c.B)*c.Weight + int(c2.B)*c2.Weight) / sumWeight),
-		A:      uint8((int(c.A)*c.Weight + int(c2.A)*c2.Weight) / sumWeight),
+		R:      uint8((float64(c.R)*c.Weight + float64(c2.R)*c2.Weight) / sumWeight),
+		G:      uint8((float64(c.G)*c.Weight + float64(c2.G)*c2.Weight) / sumWeight),
+		B:      uint8((float64(c.B)*c.Weight + float64(c2.B)*c2.Weight) / sumWeight),
+		A:      uint8((float64(c.A)*c.Weight + float64(c2.A)*c2.Weight) / sumWeight),
 		Weight: sumWeight,
 	}
 }
 
 // Average of a list of colors
 func Average(colors []Color) Color {
-	var sumR, sumG, sumB, sumA, sumWeight int
+	var sumR, sumG, sumB, sumA, sumWeight float64
 
 	for _, c := range colors {
-		sumR += int(c.R) * c.Weight
-		sumG += int(c.G) * c.Weight
-		sumB += int(c.B) * c.Weight
-		sumA += int(c.A) * c.Weight
+		sumR += float64(c.R) * c.Weight
+		sumG += float64(c.G) * c.Weight
+		sumB += float64(c.B) * c.Weight
+		sumA += float64(c.A) * c.Weight
 		sumWeight += c.Weight
 	}
 
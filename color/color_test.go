@@ -1,6 +1,7 @@
 package color
 
 import (
+	"image/color"
 	"math"
 	"testing"
 )
@@ -69,6 +70,56 @@ func TestToHex(t *testing.T) {
 	}
 }
 
+func TestNewFromRGBA(t *testing.T) {
+	// Premultiplied half transparent red
+	c := NewFromRGBA(color.RGBA{R: 128, G: 0, B: 0, A: 128})
+
+	expected := Color{R: 255, G: 0, B: 0, A: 128, Weight: 1}
+	if c != expected {
+		t.Errorf("NewFromRGBA error, expected %v, got %v", expected, c)
+	}
+}
+
+func TestNewFromHex(t *testing.T) {
+	var hexTests = []struct {
+		hex      string
+		expected Color
+		valid    bool
+	}{
+		{"#ff00ff", Color{R: 255, G: 0, B: 255, A: 255, Weight: 1}, true},
+		{"0a0b0c", Color{R: 10, G: 11, B: 12, A: 255, Weight: 1}, true},
+		{"#fff", Color{R: 255, G: 255, B: 255, A: 255, Weight: 1}, true},
+		{"#ff00f", Color{}, false},
+		{"#gg0000", Color{}, false},
+	}
+
+	for _, tt := range hexTests {
+		c, err := NewFromHex(tt.hex)
+		if tt.valid && err != nil {
+			t.Errorf("NewFromHex error for %s: %v", tt.hex, err)
+		}
+
+		if !tt.valid && err == nil {
+			t.Errorf("NewFromHex expected error for %s", tt.hex)
+		}
+
+		if c != tt.expected {
+			t.Errorf("NewFromHex error, expected %v, got %v", tt.expected, c)
+		}
+	}
+}
+
+func TestComposite(t *testing.T) {
+	c := Color{R: 255, G: 0, B: 0, A: 51, Weight: 2}
+	bg := Color{R: 255, G: 255, B: 255, A: 255}
+
+	expected := Color{R: 255, G: 204, B: 204, A: 255, Weight: 2}
+	got := c.Composite(bg)
+	if got != expected {
+		t.Errorf("Composite error, expected %v, got %v", expected, got)
+	}
+}
+
 func TestYIQDistance(t *testing.T) {
 	// c1 := Color{R: 200, G: 100, B: 20}
 	// c2 := Color{R: 100, G: 25, B: 80}
@@ -113,6 +164,26 @@ func TestNewFromHSL(t *testing.T) {
 	}
 }
 
+func TestToLab(t *testing.T) {
+	var labTests = []struct {
+		c       Color
+		l, a, b float64
+	}{
+		{Color{R: 0, G: 0, B: 0}, 0, 0, 0},
+		{Color{R: 255, G: 255, B: 255}, 100, 0, 0},
+		{Color{R: 255, G: 0, B: 0}, 53.24, 80.09, 67.20},
+		{Color{R: 0, G: 0, B: 255}, 32.30, 79.19, -107.86},
+	}
+
+	for _, tt := range labTests {
+		l, a, b := tt.c.ToLab()
+
+		inTolerance(t, tt.l, l, .01)
+		inTolerance(t, tt.a, a, .01)
+		inTolerance(t, tt.b, b, .01)
+	}
+}
+
 func TestHue2RGB(t *testing.T) {
 	p := .09
 	q := .7
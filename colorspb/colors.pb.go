@@ -0,0 +1,1408 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: colors.proto
+
+package colorspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Config of the extraction, zero values use the defaults, see models.CalculatorConfig
+type Config struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	TransparencyTreshold uint32                 `protobuf:"varint,1,opt,name=transparency_treshold,json=transparencyTreshold,proto3" json:"transparency_treshold,omitempty"`
+	IterationCount       int32                  `protobuf:"varint,2,opt,name=iteration_count,json=iterationCount,proto3" json:"iteration_count,omitempty"`
+	MinLuminance         float64                `protobuf:"fixed64,3,opt,name=min_luminance,json=minLuminance,proto3" json:"min_luminance,omitempty"`
+	MaxLuminance         float64                `protobuf:"fixed64,4,opt,name=max_luminance,json=maxLuminance,proto3" json:"max_luminance,omitempty"`
+	DistanceThreshold    float64                `protobuf:"fixed64,5,opt,name=distance_threshold,json=distanceThreshold,proto3" json:"distance_threshold,omitempty"`
+	MinSaturation        float64                `protobuf:"fixed64,6,opt,name=min_saturation,json=minSaturation,proto3" json:"min_saturation,omitempty"`
+	// simple or yiq
+	Algorithm     string `protobuf:"bytes,7,opt,name=algorithm,proto3" json:"algorithm,omitempty"`
+	AlphaWeighted bool   `protobuf:"varint,8,opt,name=alpha_weighted,json=alphaWeighted,proto3" json:"alpha_weighted,omitempty"`
+	// Hex color to composite semi-transparent pixels onto
+	Background string `protobuf:"bytes,9,opt,name=background,proto3" json:"background,omitempty"`
+	// resize, grid, random or none
+	Sampling    string `protobuf:"bytes,10,opt,name=sampling,proto3" json:"sampling,omitempty"`
+	PixelBudget int32  `protobuf:"varint,11,opt,name=pixel_budget,json=pixelBudget,proto3" json:"pixel_budget,omitempty"`
+	// nearest, box, bilinear or lanczos
+	ResizeFilter string `protobuf:"bytes,12,opt,name=resize_filter,json=resizeFilter,proto3" json:"resize_filter,omitempty"`
+	Seed         int64  `protobuf:"varint,13,opt,name=seed,proto3" json:"seed,omitempty"`
+	// floodfill or frame
+	BackgroundRemoval   string  `protobuf:"bytes,14,opt,name=background_removal,json=backgroundRemoval,proto3" json:"background_removal,omitempty"`
+	BackgroundTolerance float64 `protobuf:"fixed64,15,opt,name=background_tolerance,json=backgroundTolerance,proto3" json:"background_tolerance,omitempty"`
+	BackgroundWeight    float64 `protobuf:"fixed64,16,opt,name=background_weight,json=backgroundWeight,proto3" json:"background_weight,omitempty"`
+	// center, edge or saliency
+	SpatialWeighting string  `protobuf:"bytes,17,opt,name=spatial_weighting,json=spatialWeighting,proto3" json:"spatial_weighting,omitempty"`
+	CenterSigma      float64 `protobuf:"fixed64,18,opt,name=center_sigma,json=centerSigma,proto3" json:"center_sigma,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Config) Reset() {
+	*x = Config{}
+	mi := &file_colors_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Config) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Config) ProtoMessage() {}
+
+func (x *Config) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Config.ProtoReflect.Descriptor instead.
+func (*Config) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Config) GetTransparencyTreshold() uint32 {
+	if x != nil {
+		return x.TransparencyTreshold
+	}
+	return 0
+}
+
+func (x *Config) GetIterationCount() int32 {
+	if x != nil {
+		return x.IterationCount
+	}
+	return 0
+}
+
+func (x *Config) GetMinLuminance() float64 {
+	if x != nil {
+		return x.MinLuminance
+	}
+	return 0
+}
+
+func (x *Config) GetMaxLuminance() float64 {
+	if x != nil {
+		return x.MaxLuminance
+	}
+	return 0
+}
+
+func (x *Config) GetDistanceThreshold() float64 {
+	if x != nil {
+		return x.DistanceThreshold
+	}
+	return 0
+}
+
+func (x *Config) GetMinSaturation() float64 {
+	if x != nil {
+		return x.MinSaturation
+	}
+	return 0
+}
+
+func (x *Config) GetAlgorithm() string {
+	if x != nil {
+		return x.Algorithm
+	}
+	return ""
+}
+
+func (x *Config) GetAlphaWeighted() bool {
+	if x != nil {
+		return x.AlphaWeighted
+	}
+	return false
+}
+
+func (x *Config) GetBackground() string {
+	if x != nil {
+		return x.Background
+	}
+	return ""
+}
+
+func (x *Config) GetSampling() string {
+	if x != nil {
+		return x.Sampling
+	}
+	return ""
+}
+
+func (x *Config) GetPixelBudget() int32 {
+	if x != nil {
+		return x.PixelBudget
+	}
+	return 0
+}
+
+func (x *Config) GetResizeFilter() string {
+	if x != nil {
+		return x.ResizeFilter
+	}
+	return ""
+}
+
+func (x *Config) GetSeed() int64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+func (x *Config) GetBackgroundRemoval() string {
+	if x != nil {
+		return x.BackgroundRemoval
+	}
+	return ""
+}
+
+func (x *Config) GetBackgroundTolerance() float64 {
+	if x != nil {
+		return x.BackgroundTolerance
+	}
+	return 0
+}
+
+func (x *Config) GetBackgroundWeight() float64 {
+	if x != nil {
+		return x.BackgroundWeight
+	}
+	return 0
+}
+
+func (x *Config) GetSpatialWeighting() string {
+	if x != nil {
+		return x.SpatialWeighting
+	}
+	return ""
+}
+
+func (x *Config) GetCenterSigma() float64 {
+	if x != nil {
+		return x.CenterSigma
+	}
+	return 0
+}
+
+type Point struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	X             float64                `protobuf:"fixed64,1,opt,name=x,proto3" json:"x,omitempty"`
+	Y             float64                `protobuf:"fixed64,2,opt,name=y,proto3" json:"y,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Point) Reset() {
+	*x = Point{}
+	mi := &file_colors_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Point) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Point) ProtoMessage() {}
+
+func (x *Point) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Point.ProtoReflect.Descriptor instead.
+func (*Point) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Point) GetX() float64 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *Point) GetY() float64 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+type Rect struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	X             int32                  `protobuf:"varint,1,opt,name=x,proto3" json:"x,omitempty"`
+	Y             int32                  `protobuf:"varint,2,opt,name=y,proto3" json:"y,omitempty"`
+	Width         int32                  `protobuf:"varint,3,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,4,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Rect) Reset() {
+	*x = Rect{}
+	mi := &file_colors_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Rect) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rect) ProtoMessage() {}
+
+func (x *Rect) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rect.ProtoReflect.Descriptor instead.
+func (*Rect) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Rect) GetX() int32 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *Rect) GetY() int32 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *Rect) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Rect) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type Polygon struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Points        []*Point               `protobuf:"bytes,1,rep,name=points,proto3" json:"points,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Polygon) Reset() {
+	*x = Polygon{}
+	mi := &file_colors_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Polygon) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Polygon) ProtoMessage() {}
+
+func (x *Polygon) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Polygon.ProtoReflect.Descriptor instead.
+func (*Polygon) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Polygon) GetPoints() []*Point {
+	if x != nil {
+		return x.Points
+	}
+	return nil
+}
+
+// Selection limits the pixels used for the extraction
+type Selection struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Rect  *Rect                  `protobuf:"bytes,1,opt,name=rect,proto3" json:"rect,omitempty"`
+	// A pixel is selected if its center is inside any of the polygons
+	Polygons []*Polygon `protobuf:"bytes,2,rep,name=polygons,proto3" json:"polygons,omitempty"`
+	// PNG or JPEG mask, lighter pixels are weighted more
+	Mask          []byte `protobuf:"bytes,3,opt,name=mask,proto3" json:"mask,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Selection) Reset() {
+	*x = Selection{}
+	mi := &file_colors_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Selection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Selection) ProtoMessage() {}
+
+func (x *Selection) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Selection.ProtoReflect.Descriptor instead.
+func (*Selection) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Selection) GetRect() *Rect {
+	if x != nil {
+		return x.Rect
+	}
+	return nil
+}
+
+func (x *Selection) GetPolygons() []*Polygon {
+	if x != nil {
+		return x.Polygons
+	}
+	return nil
+}
+
+func (x *Selection) GetMask() []byte {
+	if x != nil {
+		return x.Mask
+	}
+	return nil
+}
+
+// Image is the bytes of an image or its URL
+type Image struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Source:
+	//
+	//	*Image_Data
+	//	*Image_Url
+	Source isImage_Source `protobuf_oneof:"source"`
+	// MIME type or file extension of data
+	Type string `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	// Name of the image in batch items, the URL by default
+	Name          string `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Image) Reset() {
+	*x = Image{}
+	mi := &file_colors_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Image) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Image) ProtoMessage() {}
+
+func (x *Image) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Image.ProtoReflect.Descriptor instead.
+func (*Image) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Image) GetSource() isImage_Source {
+	if x != nil {
+		return x.Source
+	}
+	return nil
+}
+
+func (x *Image) GetData() []byte {
+	if x != nil {
+		if x, ok := x.Source.(*Image_Data); ok {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+func (x *Image) GetUrl() string {
+	if x != nil {
+		if x, ok := x.Source.(*Image_Url); ok {
+			return x.Url
+		}
+	}
+	return ""
+}
+
+func (x *Image) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Image) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type isImage_Source interface {
+	isImage_Source()
+}
+
+type Image_Data struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3,oneof"`
+}
+
+type Image_Url struct {
+	Url string `protobuf:"bytes,2,opt,name=url,proto3,oneof"`
+}
+
+func (*Image_Data) isImage_Source() {}
+
+func (*Image_Url) isImage_Source() {}
+
+type ExtractRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Image     *Image                 `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	Config    *Config                `protobuf:"bytes,2,opt,name=config,proto3" json:"config,omitempty"`
+	Selection *Selection             `protobuf:"bytes,3,opt,name=selection,proto3" json:"selection,omitempty"`
+	// Include the colors of every step in the response
+	WithSteps     bool `protobuf:"varint,4,opt,name=with_steps,json=withSteps,proto3" json:"with_steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExtractRequest) Reset() {
+	*x = ExtractRequest{}
+	mi := &file_colors_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExtractRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExtractRequest) ProtoMessage() {}
+
+func (x *ExtractRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExtractRequest.ProtoReflect.Descriptor instead.
+func (*ExtractRequest) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExtractRequest) GetImage() *Image {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *ExtractRequest) GetConfig() *Config {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *ExtractRequest) GetSelection() *Selection {
+	if x != nil {
+		return x.Selection
+	}
+	return nil
+}
+
+func (x *ExtractRequest) GetWithSteps() bool {
+	if x != nil {
+		return x.WithSteps
+	}
+	return false
+}
+
+type Color struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Hex color
+	Value  string  `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Weight float64 `protobuf:"fixed64,2,opt,name=weight,proto3" json:"weight,omitempty"`
+	// Hue distance from the main color, between 0 and 1
+	HueDistance   float64 `protobuf:"fixed64,3,opt,name=hue_distance,json=hueDistance,proto3" json:"hue_distance,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Color) Reset() {
+	*x = Color{}
+	mi := &file_colors_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Color) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Color) ProtoMessage() {}
+
+func (x *Color) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Color.ProtoReflect.Descriptor instead.
+func (*Color) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Color) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *Color) GetWeight() float64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *Color) GetHueDistance() float64 {
+	if x != nil {
+		return x.HueDistance
+	}
+	return 0
+}
+
+type StepColor struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	R             uint32                 `protobuf:"varint,1,opt,name=r,proto3" json:"r,omitempty"`
+	G             uint32                 `protobuf:"varint,2,opt,name=g,proto3" json:"g,omitempty"`
+	B             uint32                 `protobuf:"varint,3,opt,name=b,proto3" json:"b,omitempty"`
+	Weight        float64                `protobuf:"fixed64,4,opt,name=weight,proto3" json:"weight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StepColor) Reset() {
+	*x = StepColor{}
+	mi := &file_colors_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StepColor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StepColor) ProtoMessage() {}
+
+func (x *StepColor) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StepColor.ProtoReflect.Descriptor instead.
+func (*StepColor) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StepColor) GetR() uint32 {
+	if x != nil {
+		return x.R
+	}
+	return 0
+}
+
+func (x *StepColor) GetG() uint32 {
+	if x != nil {
+		return x.G
+	}
+	return 0
+}
+
+func (x *StepColor) GetB() uint32 {
+	if x != nil {
+		return x.B
+	}
+	return 0
+}
+
+func (x *StepColor) GetWeight() float64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+type Step struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Colors        []*StepColor           `protobuf:"bytes,1,rep,name=colors,proto3" json:"colors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Step) Reset() {
+	*x = Step{}
+	mi := &file_colors_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Step) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Step) ProtoMessage() {}
+
+func (x *Step) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Step.ProtoReflect.Descriptor instead.
+func (*Step) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Step) GetColors() []*StepColor {
+	if x != nil {
+		return x.Colors
+	}
+	return nil
+}
+
+// ExtractResponse has the colors ordered by weight, the first one is the main color
+type ExtractResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Colors   []*Color               `protobuf:"bytes,1,rep,name=colors,proto3" json:"colors,omitempty"`
+	Gradient []string               `protobuf:"bytes,2,rep,name=gradient,proto3" json:"gradient,omitempty"`
+	// Sampled, filtered and every clustering step, only with with_steps
+	Steps         []*Step `protobuf:"bytes,3,rep,name=steps,proto3" json:"steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExtractResponse) Reset() {
+	*x = ExtractResponse{}
+	mi := &file_colors_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExtractResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExtractResponse) ProtoMessage() {}
+
+func (x *ExtractResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExtractResponse.ProtoReflect.Descriptor instead.
+func (*ExtractResponse) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ExtractResponse) GetColors() []*Color {
+	if x != nil {
+		return x.Colors
+	}
+	return nil
+}
+
+func (x *ExtractResponse) GetGradient() []string {
+	if x != nil {
+		return x.Gradient
+	}
+	return nil
+}
+
+func (x *ExtractResponse) GetSteps() []*Step {
+	if x != nil {
+		return x.Steps
+	}
+	return nil
+}
+
+type UploadHeader struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// MIME type or file extension of the image
+	Type          string     `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Config        *Config    `protobuf:"bytes,2,opt,name=config,proto3" json:"config,omitempty"`
+	Selection     *Selection `protobuf:"bytes,3,opt,name=selection,proto3" json:"selection,omitempty"`
+	WithSteps     bool       `protobuf:"varint,4,opt,name=with_steps,json=withSteps,proto3" json:"with_steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadHeader) Reset() {
+	*x = UploadHeader{}
+	mi := &file_colors_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadHeader) ProtoMessage() {}
+
+func (x *UploadHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadHeader.ProtoReflect.Descriptor instead.
+func (*UploadHeader) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UploadHeader) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetConfig() *Config {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *UploadHeader) GetSelection() *Selection {
+	if x != nil {
+		return x.Selection
+	}
+	return nil
+}
+
+func (x *UploadHeader) GetWithSteps() bool {
+	if x != nil {
+		return x.WithSteps
+	}
+	return false
+}
+
+type UploadRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*UploadRequest_Header
+	//	*UploadRequest_Chunk
+	Part          isUploadRequest_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadRequest) Reset() {
+	*x = UploadRequest{}
+	mi := &file_colors_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadRequest) ProtoMessage() {}
+
+func (x *UploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadRequest.ProtoReflect.Descriptor instead.
+func (*UploadRequest) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UploadRequest) GetPart() isUploadRequest_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetHeader() *UploadHeader {
+	if x != nil {
+		if x, ok := x.Part.(*UploadRequest_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*UploadRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isUploadRequest_Part interface {
+	isUploadRequest_Part()
+}
+
+type UploadRequest_Header struct {
+	Header *UploadHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type UploadRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*UploadRequest_Header) isUploadRequest_Part() {}
+
+func (*UploadRequest_Chunk) isUploadRequest_Part() {}
+
+type BatchRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Images []*Image               `protobuf:"bytes,1,rep,name=images,proto3" json:"images,omitempty"`
+	Config *Config                `protobuf:"bytes,2,opt,name=config,proto3" json:"config,omitempty"`
+	// The mask is not supported in batches
+	Selection     *Selection `protobuf:"bytes,3,opt,name=selection,proto3" json:"selection,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_colors_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *BatchRequest) GetImages() []*Image {
+	if x != nil {
+		return x.Images
+	}
+	return nil
+}
+
+func (x *BatchRequest) GetConfig() *Config {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *BatchRequest) GetSelection() *Selection {
+	if x != nil {
+		return x.Selection
+	}
+	return nil
+}
+
+// Error of a batch item, code is one of the codes of the HTTP API
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Field         string                 `protobuf:"bytes,3,opt,name=field,proto3" json:"field,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_colors_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+type BatchItem struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Index int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Name  string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Types that are valid to be assigned to Outcome:
+	//
+	//	*BatchItem_Result
+	//	*BatchItem_Error
+	Outcome       isBatchItem_Outcome `protobuf_oneof:"outcome"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchItem) Reset() {
+	*x = BatchItem{}
+	mi := &file_colors_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchItem) ProtoMessage() {}
+
+func (x *BatchItem) ProtoReflect() protoreflect.Message {
+	mi := &file_colors_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchItem.ProtoReflect.Descriptor instead.
+func (*BatchItem) Descriptor() ([]byte, []int) {
+	return file_colors_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *BatchItem) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *BatchItem) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *BatchItem) GetOutcome() isBatchItem_Outcome {
+	if x != nil {
+		return x.Outcome
+	}
+	return nil
+}
+
+func (x *BatchItem) GetResult() *ExtractResponse {
+	if x != nil {
+		if x, ok := x.Outcome.(*BatchItem_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+func (x *BatchItem) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Outcome.(*BatchItem_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+type isBatchItem_Outcome interface {
+	isBatchItem_Outcome()
+}
+
+type BatchItem_Result struct {
+	Result *ExtractResponse `protobuf:"bytes,3,opt,name=result,proto3,oneof"`
+}
+
+type BatchItem_Error struct {
+	Error *Error `protobuf:"bytes,4,opt,name=error,proto3,oneof"`
+}
+
+func (*BatchItem_Result) isBatchItem_Outcome() {}
+
+func (*BatchItem_Error) isBatchItem_Outcome() {}
+
+var File_colors_proto protoreflect.FileDescriptor
+
+const file_colors_proto_rawDesc = "" +
+	"\n" +
+	"\fcolors.proto\x12\x0fcommoncolors.v1\"\xc2\x05\n" +
+	"\x06Config\x123\n" +
+	"\x15transparency_treshold\x18\x01 \x01(\rR\x14transparencyTreshold\x12'\n" +
+	"\x0fiteration_count\x18\x02 \x01(\x05R\x0eiterationCount\x12#\n" +
+	"\rmin_luminance\x18\x03 \x01(\x01R\fminLuminance\x12#\n" +
+	"\rmax_luminance\x18\x04 \x01(\x01R\fmaxLuminance\x12-\n" +
+	"\x12distance_threshold\x18\x05 \x01(\x01R\x11distanceThreshold\x12%\n" +
+	"\x0emin_saturation\x18\x06 \x01(\x01R\rminSaturation\x12\x1c\n" +
+	"\talgorithm\x18\a \x01(\tR\talgorithm\x12%\n" +
+	"\x0ealpha_weighted\x18\b \x01(\bR\ralphaWeighted\x12\x1e\n" +
+	"\n" +
+	"background\x18\t \x01(\tR\n" +
+	"background\x12\x1a\n" +
+	"\bsampling\x18\n" +
+	" \x01(\tR\bsampling\x12!\n" +
+	"\fpixel_budget\x18\v \x01(\x05R\vpixelBudget\x12#\n" +
+	"\rresize_filter\x18\f \x01(\tR\fresizeFilter\x12\x12\n" +
+	"\x04seed\x18\r \x01(\x03R\x04seed\x12-\n" +
+	"\x12background_removal\x18\x0e \x01(\tR\x11backgroundRemoval\x121\n" +
+	"\x14background_tolerance\x18\x0f \x01(\x01R\x13backgroundTolerance\x12+\n" +
+	"\x11background_weight\x18\x10 \x01(\x01R\x10backgroundWeight\x12+\n" +
+	"\x11spatial_weighting\x18\x11 \x01(\tR\x10spatialWeighting\x12!\n" +
+	"\fcenter_sigma\x18\x12 \x01(\x01R\vcenterSigma\"#\n" +
+	"\x05Point\x12\f\n" +
+	"\x01x\x18\x01 \x01(\x01R\x01x\x12\f\n" +
+	"\x01y\x18\x02 \x01(\x01R\x01y\"P\n" +
+	"\x04Rect\x12\f\n" +
+	"\x01x\x18\x01 \x01(\x05R\x01x\x12\f\n" +
+	"\x01y\x18\x02 \x01(\x05R\x01y\x12\x14\n" +
+	"\x05width\x18\x03 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x04 \x01(\x05R\x06height\"9\n" +
+	"\aPolygon\x12.\n" +
+	"\x06points\x18\x01 \x03(\v2\x16.commoncolors.v1.PointR\x06points\"\x80\x01\n" +
+	"\tSelection\x12)\n" +
+	"\x04rect\x18\x01 \x01(\v2\x15.commoncolors.v1.RectR\x04rect\x124\n" +
+	"\bpolygons\x18\x02 \x03(\v2\x18.commoncolors.v1.PolygonR\bpolygons\x12\x12\n" +
+	"\x04mask\x18\x03 \x01(\fR\x04mask\"c\n" +
+	"\x05Image\x12\x14\n" +
+	"\x04data\x18\x01 \x01(\fH\x00R\x04data\x12\x12\n" +
+	"\x03url\x18\x02 \x01(\tH\x00R\x03url\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04nameB\b\n" +
+	"\x06source\"\xc8\x01\n" +
+	"\x0eExtractRequest\x12,\n" +
+	"\x05image\x18\x01 \x01(\v2\x16.commoncolors.v1.ImageR\x05image\x12/\n" +
+	"\x06config\x18\x02 \x01(\v2\x17.commoncolors.v1.ConfigR\x06config\x128\n" +
+	"\tselection\x18\x03 \x01(\v2\x1a.commoncolors.v1.SelectionR\tselection\x12\x1d\n" +
+	"\n" +
+	"with_steps\x18\x04 \x01(\bR\twithSteps\"X\n" +
+	"\x05Color\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12\x16\n" +
+	"\x06weight\x18\x02 \x01(\x01R\x06weight\x12!\n" +
+	"\fhue_distance\x18\x03 \x01(\x01R\vhueDistance\"M\n" +
+	"\tStepColor\x12\f\n" +
+	"\x01r\x18\x01 \x01(\rR\x01r\x12\f\n" +
+	"\x01g\x18\x02 \x01(\rR\x01g\x12\f\n" +
+	"\x01b\x18\x03 \x01(\rR\x01b\x12\x16\n" +
+	"\x06weight\x18\x04 \x01(\x01R\x06weight\":\n" +
+	"\x04Step\x122\n" +
+	"\x06colors\x18\x01 \x03(\v2\x1a.commoncolors.v1.StepColorR\x06colors\"\x8a\x01\n" +
+	"\x0fExtractResponse\x12.\n" +
+	"\x06colors\x18\x01 \x03(\v2\x16.commoncolors.v1.ColorR\x06colors\x12\x1a\n" +
+	"\bgradient\x18\x02 \x03(\tR\bgradient\x12+\n" +
+	"\x05steps\x18\x03 \x03(\v2\x15.commoncolors.v1.StepR\x05steps\"\xac\x01\n" +
+	"\fUploadHeader\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12/\n" +
+	"\x06config\x18\x02 \x01(\v2\x17.commoncolors.v1.ConfigR\x06config\x128\n" +
+	"\tselection\x18\x03 \x01(\v2\x1a.commoncolors.v1.SelectionR\tselection\x12\x1d\n" +
+	"\n" +
+	"with_steps\x18\x04 \x01(\bR\twithSteps\"h\n" +
+	"\rUploadRequest\x127\n" +
+	"\x06header\x18\x01 \x01(\v2\x1d.commoncolors.v1.UploadHeaderH\x00R\x06header\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04part\"\xa9\x01\n" +
+	"\fBatchRequest\x12.\n" +
+	"\x06images\x18\x01 \x03(\v2\x16.commoncolors.v1.ImageR\x06images\x12/\n" +
+	"\x06config\x18\x02 \x01(\v2\x17.commoncolors.v1.ConfigR\x06config\x128\n" +
+	"\tselection\x18\x03 \x01(\v2\x1a.commoncolors.v1.SelectionR\tselection\"K\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x14\n" +
+	"\x05field\x18\x03 \x01(\tR\x05field\"\xac\x01\n" +
+	"\tBatchItem\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12:\n" +
+	"\x06result\x18\x03 \x01(\v2 .commoncolors.v1.ExtractResponseH\x00R\x06result\x12.\n" +
+	"\x05error\x18\x04 \x01(\v2\x16.commoncolors.v1.ErrorH\x00R\x05errorB\t\n" +
+	"\aoutcome2\xf0\x01\n" +
+	"\fCommonColors\x12L\n" +
+	"\aExtract\x12\x1f.commoncolors.v1.ExtractRequest\x1a .commoncolors.v1.ExtractResponse\x12L\n" +
+	"\x06Upload\x12\x1e.commoncolors.v1.UploadRequest\x1a .commoncolors.v1.ExtractResponse(\x01\x12D\n" +
+	"\x05Batch\x12\x1d.commoncolors.v1.BatchRequest\x1a\x1a.commoncolors.v1.BatchItem0\x01B/Z-github.com/simonmarton/common-colors/colorspbb\x06proto3"
+
+var (
+	file_colors_proto_rawDescOnce sync.Once
+	file_colors_proto_rawDescData []byte
+)
+
+func file_colors_proto_rawDescGZIP() []byte {
+	file_colors_proto_rawDescOnce.Do(func() {
+		file_colors_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_colors_proto_rawDesc), len(file_colors_proto_rawDesc)))
+	})
+	return file_colors_proto_rawDescData
+}
+
+var file_colors_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_colors_proto_goTypes = []any{
+	(*Config)(nil),          // 0: commoncolors.v1.Config
+	(*Point)(nil),           // 1: commoncolors.v1.Point
+	(*Rect)(nil),            // 2: commoncolors.v1.Rect
+	(*Polygon)(nil),         // 3: commoncolors.v1.Polygon
+	(*Selection)(nil),       // 4: commoncolors.v1.Selection
+	(*Image)(nil),           // 5: commoncolors.v1.Image
+	(*ExtractRequest)(nil),  // 6: commoncolors.v1.ExtractRequest
+	(*Color)(nil),           // 7: commoncolors.v1.Color
+	(*StepColor)(nil),       // 8: commoncolors.v1.StepColor
+	(*Step)(nil),            // 9: commoncolors.v1.Step
+	(*ExtractResponse)(nil), // 10: commoncolors.v1.ExtractResponse
+	(*UploadHeader)(nil),    // 11: commoncolors.v1.UploadHeader
+	(*UploadRequest)(nil),   // 12: commoncolors.v1.UploadRequest
+	(*BatchRequest)(nil),    // 13: commoncolors.v1.BatchRequest
+	(*Error)(nil),           // 14: commoncolors.v1.Error
+	(*BatchItem)(nil),       // 15: commoncolors.v1.BatchItem
+}
+var file_colors_proto_depIdxs = []int32{
+	1,  // 0: commoncolors.v1.Polygon.points:type_name -> commoncolors.v1.Point
+	2,  // 1: commoncolors.v1.Selection.rect:type_name -> commoncolors.v1.Rect
+	3,  // 2: commoncolors.v1.Selection.polygons:type_name -> commoncolors.v1.Polygon
+	5,  // 3: commoncolors.v1.ExtractRequest.image:type_name -> commoncolors.v1.Image
+	0,  // 4: commoncolors.v1.ExtractRequest.config:type_name -> commoncolors.v1.Config
+	4,  // 5: commoncolors.v1.ExtractRequest.selection:type_name -> commoncolors.v1.Selection
+	8,  // 6: commoncolors.v1.Step.colors:type_name -> commoncolors.v1.StepColor
+	7,  // 7: commoncolors.v1.ExtractResponse.colors:type_name -> commoncolors.v1.Color
+	9,  // 8: commoncolors.v1.ExtractResponse.steps:type_name -> commoncolors.v1.Step
+	0,  // 9: commoncolors.v1.UploadHeader.config:type_name -> commoncolors.v1.Config
+	4,  // 10: commoncolors.v1.UploadHeader.selection:type_name -> commoncolors.v1.Selection
+	11, // 11: commoncolors.v1.UploadRequest.header:type_name -> commoncolors.v1.UploadHeader
+	5,  // 12: commoncolors.v1.BatchRequest.images:type_name -> commoncolors.v1.Image
+	0,  // 13: commoncolors.v1.BatchRequest.config:type_name -> commoncolors.v1.Config
+	4,  // 14: commoncolors.v1.BatchRequest.selection:type_name -> commoncolors.v1.Selection
+	10, // 15: commoncolors.v1.BatchItem.result:type_name -> commoncolors.v1.ExtractResponse
+	14, // 16: commoncolors.v1.BatchItem.error:type_name -> commoncolors.v1.Error
+	6,  // 17: commoncolors.v1.CommonColors.Extract:input_type -> commoncolors.v1.ExtractRequest
+	12, // 18: commoncolors.v1.CommonColors.Upload:input_type -> commoncolors.v1.UploadRequest
+	13, // 19: commoncolors.v1.CommonColors.Batch:input_type -> commoncolors.v1.BatchRequest
+	10, // 20: commoncolors.v1.CommonColors.Extract:output_type -> commoncolors.v1.ExtractResponse
+	10, // 21: commoncolors.v1.CommonColors.Upload:output_type -> commoncolors.v1.ExtractResponse
+	15, // 22: commoncolors.v1.CommonColors.Batch:output_type -> commoncolors.v1.BatchItem
+	20, // [20:23] is the sub-list for method output_type
+	17, // [17:20] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	17, // [17:17] is the sub-list for extension extendee
+	0,  // [0:17] is the sub-list for field type_name
+}
+
+func init() { file_colors_proto_init() }
+func file_colors_proto_init() {
+	if File_colors_proto != nil {
+		return
+	}
+	file_colors_proto_msgTypes[5].OneofWrappers = []any{
+		(*Image_Data)(nil),
+		(*Image_Url)(nil),
+	}
+	file_colors_proto_msgTypes[12].OneofWrappers = []any{
+		(*UploadRequest_Header)(nil),
+		(*UploadRequest_Chunk)(nil),
+	}
+	file_colors_proto_msgTypes[15].OneofWrappers = []any{
+		(*BatchItem_Result)(nil),
+		(*BatchItem_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_colors_proto_rawDesc), len(file_colors_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_colors_proto_goTypes,
+		DependencyIndexes: file_colors_proto_depIdxs,
+		MessageInfos:      file_colors_proto_msgTypes,
+	}.Build()
+	File_colors_proto = out.File
+	file_colors_proto_goTypes = nil
+	file_colors_proto_depIdxs = nil
+}
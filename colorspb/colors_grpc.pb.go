@@ -0,0 +1,204 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: colors.proto
+
+package colorspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CommonColors_Extract_FullMethodName = "/commoncolors.v1.CommonColors/Extract"
+	CommonColors_Upload_FullMethodName  = "/commoncolors.v1.CommonColors/Upload"
+	CommonColors_Batch_FullMethodName   = "/commoncolors.v1.CommonColors/Batch"
+)
+
+// CommonColorsClient is the client API for CommonColors service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CommonColors is the gRPC counterpart of the /api/v1 HTTP routes
+type CommonColorsClient interface {
+	// Extract the common colors of an image sent in one message or of an image URL
+	Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (*ExtractResponse, error)
+	// Upload a large image in chunks, the first message is the header with the config
+	Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, ExtractResponse], error)
+	// Batch extracts every image of the request and streams the items as they finish
+	Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BatchItem], error)
+}
+
+type commonColorsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCommonColorsClient(cc grpc.ClientConnInterface) CommonColorsClient {
+	return &commonColorsClient{cc}
+}
+
+func (c *commonColorsClient) Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (*ExtractResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExtractResponse)
+	err := c.cc.Invoke(ctx, CommonColors_Extract_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *commonColorsClient) Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, ExtractResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CommonColors_ServiceDesc.Streams[0], CommonColors_Upload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadRequest, ExtractResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CommonColors_UploadClient = grpc.ClientStreamingClient[UploadRequest, ExtractResponse]
+
+func (c *commonColorsClient) Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BatchItem], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CommonColors_ServiceDesc.Streams[1], CommonColors_Batch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BatchRequest, BatchItem]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CommonColors_BatchClient = grpc.ServerStreamingClient[BatchItem]
+
+// CommonColorsServer is the server API for CommonColors service.
+// All implementations must embed UnimplementedCommonColorsServer
+// for forward compatibility.
+//
+// CommonColors is the gRPC counterpart of the /api/v1 HTTP routes
+type CommonColorsServer interface {
+	// Extract the common colors of an image sent in one message or of an image URL
+	Extract(context.Context, *ExtractRequest) (*ExtractResponse, error)
+	// Upload a large image in chunks, the first message is the header with the config
+	Upload(grpc.ClientStreamingServer[UploadRequest, ExtractResponse]) error
+	// Batch extracts every image of the request and streams the items as they finish
+	Batch(*BatchRequest, grpc.ServerStreamingServer[BatchItem]) error
+	mustEmbedUnimplementedCommonColorsServer()
+}
+
+// UnimplementedCommonColorsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCommonColorsServer struct{}
+
+func (UnimplementedCommonColorsServer) Extract(context.Context, *ExtractRequest) (*ExtractResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Extract not implemented")
+}
+func (UnimplementedCommonColorsServer) Upload(grpc.ClientStreamingServer[UploadRequest, ExtractResponse]) error {
+	return status.Error(codes.Unimplemented, "method Upload not implemented")
+}
+func (UnimplementedCommonColorsServer) Batch(*BatchRequest, grpc.ServerStreamingServer[BatchItem]) error {
+	return status.Error(codes.Unimplemented, "method Batch not implemented")
+}
+func (UnimplementedCommonColorsServer) mustEmbedUnimplementedCommonColorsServer() {}
+func (UnimplementedCommonColorsServer) testEmbeddedByValue()                      {}
+
+// UnsafeCommonColorsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CommonColorsServer will
+// result in compilation errors.
+type UnsafeCommonColorsServer interface {
+	mustEmbedUnimplementedCommonColorsServer()
+}
+
+func RegisterCommonColorsServer(s grpc.ServiceRegistrar, srv CommonColorsServer) {
+	// If the following call panics, it indicates UnimplementedCommonColorsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CommonColors_ServiceDesc, srv)
+}
+
+func _CommonColors_Extract_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExtractRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CommonColorsServer).Extract(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CommonColors_Extract_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CommonColorsServer).Extract(ctx, req.(*ExtractRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CommonColors_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CommonColorsServer).Upload(&grpc.GenericServerStream[UploadRequest, ExtractResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CommonColors_UploadServer = grpc.ClientStreamingServer[UploadRequest, ExtractResponse]
+
+func _CommonColors_Batch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CommonColorsServer).Batch(m, &grpc.GenericServerStream[BatchRequest, BatchItem]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CommonColors_BatchServer = grpc.ServerStreamingServer[BatchItem]
+
+// CommonColors_ServiceDesc is the grpc.ServiceDesc for CommonColors service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CommonColors_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "commoncolors.v1.CommonColors",
+	HandlerType: (*CommonColorsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Extract",
+			Handler:    _CommonColors_Extract_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Upload",
+			Handler:       _CommonColors_Upload_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Batch",
+			Handler:       _CommonColors_Batch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "colors.proto",
+}
@@ -0,0 +1,4 @@
+// Package colorspb has the protobuf messages and the gRPC service of the common colors API
+package colorspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative colors.proto
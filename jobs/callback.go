@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Sign returns the X-Signature header value of a callback payload
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the X-Signature header of a callback in constant time
+func Verify(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
+
+// notify posts the finished job to its callback URL, retried with a growing delay on failure
+// until the context is done
+func (q *Queue) notify(ctx context.Context, job Job) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+
+	delay := q.retryDelay
+	for attempt := 0; attempt < callbackAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				q.config.Logger.Warn("Callback dropped", "job_id", job.ID, "url", job.CallbackURL, "attempts", attempt)
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		if q.post(job, payload) {
+			return
+		}
+	}
+
+	q.config.Logger.Warn("Callback failed", "job_id", job.ID, "url", job.CallbackURL, "attempts", callbackAttempts)
+}
+
+// post sends one attempt of the callback, true if it was accepted
+func (q *Queue) post(job Job, payload []byte) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCallbackTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return false
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-ID", job.ID)
+	req.Header.Set("X-Signature", Sign(q.config.Secret, payload))
+
+	resp, err := q.config.Client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode < 300
+}
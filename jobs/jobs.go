@@ -0,0 +1,478 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/simonmarton/common-colors/logging"
+	"github.com/simonmarton/common-colors/models"
+)
+
+const defaultWorkers = 2
+const defaultQueueSize = 1000
+const defaultCallbackTimeout = 10 * time.Second
+const callbackAttempts = 3
+const defaultRetention = 24 * time.Hour
+const pruneInterval = 10 * time.Minute
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = errors.New("Job not found")
+
+// ErrQueueFull is returned by Submit when QueueSize jobs are already waiting
+var ErrQueueFull = errors.New("Job queue is full")
+
+// ErrNoSecret is returned by Submit for a job with a callback URL when the Queue has no Secret,
+// callbacks are never sent unsigned
+var ErrNoSecret = errors.New("Callbacks need a webhook secret")
+
+// Status of a job
+type Status string
+
+// Statuses, a job ends in done, failed or canceled
+const (
+	Queued   Status = "queued"
+	Running  Status = "running"
+	Done     Status = "done"
+	Failed   Status = "failed"
+	Canceled Status = "canceled"
+)
+
+// Finished tells whether the job won't change anymore
+func (s Status) Finished() bool {
+	return s == Done || s == Failed || s == Canceled
+}
+
+// Input is what a job extracts the colors from, either a URL or the bytes of an image
+type Input struct {
+	URL string `json:"url,omitempty"`
+	// Image is persisted separately by the Store, it's not part of the job JSON
+	Image     []byte                  `json:"-"`
+	ImageType string                  `json:"imageType,omitempty"`
+	Config    models.CalculatorConfig `json:"config"`
+	Selection models.Selection        `json:"selection"`
+}
+
+// Job is an extraction running in the background
+type Job struct {
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	// Progress is between 0 and 1
+	Progress    float64                  `json:"progress"`
+	Input       Input                    `json:"input"`
+	CallbackURL string                   `json:"callbackUrl,omitempty"`
+	Result      *models.CommonColorsResp `json:"result,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+	CreatedAt   time.Time                `json:"createdAt"`
+	UpdatedAt   time.Time                `json:"updatedAt"`
+}
+
+// Processor runs the extraction of a job, progress can be called with values between 0 and 1
+type Processor func(ctx context.Context, job Job, progress func(float64)) (models.CommonColorsResp, error)
+
+// Config of a Queue
+type Config struct {
+	// Store persists the jobs, a FileStore in the temp dir if not set
+	Store Store
+	// Workers is the number of jobs processed at the same time
+	Workers int
+	// QueueSize limits the number of waiting jobs, Submit fails with ErrQueueFull when
+	// QueueSize jobs are waiting besides the Workers running ones
+	QueueSize int
+	// Retention is how long finished jobs and their images are kept in the Store
+	Retention time.Duration
+
+	// Client sends the callbacks, it should block private networks as the URLs come from users
+	Client *http.Client
+	// Secret signs the callback payloads with HMAC-SHA256 in the X-Signature header
+	Secret string
+
+	// Logger gets the finished jobs and failed callbacks, nothing is logged if nil
+	Logger *slog.Logger
+}
+
+// Queue processes jobs in the background
+type Queue struct {
+	config     Config
+	pending    chan string
+	now        func() time.Time
+	retryDelay time.Duration
+
+	mu     sync.Mutex
+	active map[string]*activeJob
+
+	// callbacks are the deliveries in progress, they don't hold a worker
+	callbacks sync.WaitGroup
+}
+
+// activeJob is a queued or running job
+type activeJob struct {
+	job    Job
+	cancel context.CancelFunc
+}
+
+// New creates a Queue, zero values are replaced with defaults, Run starts processing
+func New(c Config) (*Queue, error) {
+	c.Logger = logging.Or(c.Logger)
+
+	if c.Store == nil {
+		store, err := NewFileStore(filepath.Join(os.TempDir(), "common-colors-jobs"))
+		if err != nil {
+			return nil, err
+		}
+		c.Store = store.WithLogger(c.Logger)
+	}
+
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultQueueSize
+	}
+
+	if c.Retention <= 0 {
+		c.Retention = defaultRetention
+	}
+
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: defaultCallbackTimeout}
+	}
+
+	return &Queue{
+		config:     c,
+		pending:    make(chan string, c.QueueSize+c.Workers),
+		now:        time.Now,
+		retryDelay: time.Second,
+		active:     map[string]*activeJob{},
+	}, nil
+}
+
+// Submit stores and enqueues a new job
+func (q *Queue) Submit(in Input, callbackURL string) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	if callbackURL != "" && q.config.Secret == "" {
+		return Job{}, ErrNoSecret
+	}
+
+	now := q.now()
+	job := Job{ID: id, Status: Queued, Input: in, CallbackURL: callbackURL, CreatedAt: now, UpdatedAt: now}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Queued and running jobs, the resumed ones can be more than the capacity
+	if len(q.active) >= cap(q.pending) {
+		return Job{}, ErrQueueFull
+	}
+
+	if err := q.config.Store.Save(&job); err != nil {
+		return Job{}, err
+	}
+
+	// The image is only kept in the Store until the job is processed
+	q.active[id] = &activeJob{job: withoutImage(job)}
+	q.pending <- id
+
+	return withoutImage(job), nil
+}
+
+// Get returns the current state of a job
+func (q *Queue) Get(id string) (Job, error) {
+	if !validID(id) {
+		return Job{}, ErrNotFound
+	}
+
+	q.mu.Lock()
+	aj, ok := q.active[id]
+	var job Job
+	if ok {
+		job = aj.job
+	}
+	q.mu.Unlock()
+
+	if ok {
+		return withoutImage(job), nil
+	}
+
+	stored, err := q.config.Store.Load(id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return withoutImage(*stored), nil
+}
+
+// Cancel stops a queued or running job, finished jobs are deleted
+func (q *Queue) Cancel(id string) (Job, error) {
+	if !validID(id) {
+		return Job{}, ErrNotFound
+	}
+
+	q.mu.Lock()
+	aj, ok := q.active[id]
+	if !ok {
+		q.mu.Unlock()
+
+		stored, err := q.config.Store.Load(id)
+		if err != nil {
+			return Job{}, err
+		}
+
+		return withoutImage(*stored), q.config.Store.Delete(id)
+	}
+
+	if aj.cancel != nil {
+		aj.cancel()
+	}
+
+	// The worker finishes a running job, a queued one is skipped when it's picked up
+	aj.job.Status = Canceled
+	aj.job.UpdatedAt = q.now()
+	job := aj.job
+	q.config.Store.Save(&job)
+	q.mu.Unlock()
+
+	return withoutImage(job), nil
+}
+
+// Run processes jobs until the context is done, unfinished jobs of the Store are resumed first.
+// Finished jobs are deleted from the Store after Retention. The error of resuming is returned
+// right away, no job is processed then.
+func (q *Queue) Run(ctx context.Context, process Processor) error {
+	backlog, err := q.resume()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		// The rest stays queued in the store for the next Run if the context is done first
+		for _, id := range backlog {
+			select {
+			case <-ctx.Done():
+				return
+			case q.pending <- id:
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := q.prune(); err != nil {
+				q.config.Logger.Warn("Pruning jobs failed", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	for w := 0; w < q.config.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-q.pending:
+					q.process(ctx, id, process)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	q.callbacks.Wait()
+
+	return ctx.Err()
+}
+
+// prune deletes the jobs which finished more than Retention ago
+func (q *Queue) prune() error {
+	stored, err := q.config.Store.List()
+	if err != nil {
+		return err
+	}
+
+	expired := q.now().Add(-q.config.Retention)
+	for _, job := range stored {
+		if !job.Status.Finished() || job.UpdatedAt.After(expired) {
+			continue
+		}
+
+		if err := q.config.Store.Delete(job.ID); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resume marks the jobs which were queued or running when the process stopped as active
+// and returns their IDs to be enqueued, there can be more of them than the capacity of the queue
+func (q *Queue) resume() (backlog []string, err error) {
+	stored, err := q.config.Store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range stored {
+		if job.Status.Finished() {
+			continue
+		}
+
+		if _, ok := q.active[job.ID]; ok {
+			continue
+		}
+
+		job.Status = Queued
+		job.Progress = 0
+		q.active[job.ID] = &activeJob{job: withoutImage(*job)}
+		backlog = append(backlog, job.ID)
+	}
+
+	return backlog, nil
+}
+
+func (q *Queue) process(parent context.Context, id string, process Processor) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	q.mu.Lock()
+	aj, ok := q.active[id]
+	if !ok || aj.job.Status != Queued {
+		delete(q.active, id)
+		q.mu.Unlock()
+		return
+	}
+
+	aj.cancel = cancel
+	aj.job.Status = Running
+	aj.job.UpdatedAt = q.now()
+	job := aj.job
+	q.config.Store.Save(&job)
+	q.mu.Unlock()
+
+	var err error
+	if job.Input.URL == "" {
+		job.Input.Image, err = q.image(id)
+	}
+
+	var result models.CommonColorsResp
+	if err == nil {
+		result, err = q.run(ctx, job, process, func(progress float64) {
+			q.mu.Lock()
+			aj.job.Progress = progress
+			q.mu.Unlock()
+		})
+	}
+
+	q.mu.Lock()
+	switch {
+	case aj.job.Status == Canceled:
+	case parent.Err() != nil:
+		// Stopped with the queue, stays running in the store to be resumed by the next Run
+		delete(q.active, id)
+		q.mu.Unlock()
+		return
+	case err != nil:
+		aj.job.Status = Failed
+		aj.job.Error = err.Error()
+	default:
+		aj.job.Status = Done
+		aj.job.Progress = 1
+		aj.job.Result = &result
+	}
+	aj.job.UpdatedAt = q.now()
+	job = aj.job
+	q.config.Store.Save(&job)
+	delete(q.active, id)
+	q.mu.Unlock()
+
+	q.config.Logger.Info("Job finished", "job_id", id, "status", job.Status, "error", job.Error)
+
+	if job.CallbackURL != "" {
+		q.callbacks.Add(1)
+		go func() {
+			defer q.callbacks.Done()
+			q.notify(parent, withoutImage(job))
+		}()
+	}
+}
+
+// image loads the input image of a job from the Store
+func (q *Queue) image(id string) ([]byte, error) {
+	stored, err := q.config.Store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored.Input.Image, nil
+}
+
+// run calls the processor, its panic fails the job instead of crashing the queue
+func (q *Queue) run(ctx context.Context, job Job, process Processor, progress func(float64)) (result models.CommonColorsResp, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			q.config.Logger.Error("Job panicked", "job_id", job.ID, "panic", v, "stack", string(debug.Stack()))
+			err = fmt.Errorf("Panic: %v", v)
+		}
+	}()
+
+	return process(ctx, job, progress)
+}
+
+func withoutImage(job Job) Job {
+	job.Input.Image = nil
+	return job
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// validID keeps IDs from the URL out of the file paths of the store
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
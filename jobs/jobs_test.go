@@ -0,0 +1,307 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simonmarton/common-colors/models"
+)
+
+func testQueue(t *testing.T, c Config) *Queue {
+	if c.Store == nil {
+		c.Store = NewMemoryStore()
+	}
+
+	q, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.retryDelay = time.Millisecond
+
+	return q
+}
+
+func waitFor(t *testing.T, q *Queue, id string, status Status) Job {
+	for i := 0; i < 200; i++ {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("Job %s never became %s", id, status)
+	return Job{}
+}
+
+func (q *Queue) isActive(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.active[id]
+	return ok
+}
+
+func gradientProcessor(ctx context.Context, job Job, progress func(float64)) (models.CommonColorsResp, error) {
+	progress(.5)
+	if string(job.Input.Image) == "broken" {
+		return models.CommonColorsResp{}, errors.New("Broken image")
+	}
+	if string(job.Input.Image) == "panic" {
+		panic("Broken processor")
+	}
+
+	return models.CommonColorsResp{Gradient: []string{string(job.Input.Image)}}, nil
+}
+
+func TestQueue(t *testing.T) {
+	q := testQueue(t, Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, gradientProcessor)
+
+	ok, err := q.Submit(Input{Image: []byte("#ffffff")}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken, _ := q.Submit(Input{Image: []byte("broken")}, "")
+	panicked, _ := q.Submit(Input{Image: []byte("panic")}, "")
+
+	job := waitFor(t, q, ok.ID, Done)
+	if job.Progress != 1 || job.Result == nil || job.Result.Gradient[0] != "#ffffff" {
+		t.Errorf("Expected finished job with result, got %+v", job)
+	}
+
+	if job.Input.Image != nil {
+		t.Errorf("Expected the image to be left out")
+	}
+
+	job = waitFor(t, q, broken.ID, Failed)
+	if job.Error != "Broken image" {
+		t.Errorf("Expected the error of the job, got %s", job.Error)
+	}
+
+	job = waitFor(t, q, panicked.ID, Failed)
+	if job.Error != "Panic: Broken processor" {
+		t.Errorf("Expected the panic to fail the job, got %s", job.Error)
+	}
+
+	if _, err := q.Submit(Input{}, "http://a"); err != ErrNoSecret {
+		t.Errorf("Expected ErrNoSecret for a callback without a secret, got %v", err)
+	}
+
+	if _, err := q.Get("00000000000000000000000000000000"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := q.Get("../../etc/passwd"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an invalid ID, got %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	q := testQueue(t, Config{Workers: 1})
+
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, func(ctx context.Context, job Job, progress func(float64)) (models.CommonColorsResp, error) {
+		close(started)
+		<-ctx.Done()
+		return models.CommonColorsResp{}, ctx.Err()
+	})
+
+	running, _ := q.Submit(Input{}, "")
+	queued, _ := q.Submit(Input{}, "")
+	<-started
+
+	if job, _ := q.Cancel(queued.ID); job.Status != Canceled {
+		t.Errorf("Expected queued job to be canceled, got %s", job.Status)
+	}
+
+	q.Cancel(running.ID)
+	waitFor(t, q, running.ID, Canceled)
+
+	// Wait for the worker to let go of it
+	for i := 0; i < 200 && q.isActive(running.ID); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// A finished job is deleted
+	q.Cancel(running.ID)
+	if _, err := q.Get(running.ID); err != ErrNotFound {
+		t.Errorf("Expected deleted job, got %v", err)
+	}
+}
+
+func TestCallback(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// The first attempt fails
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer srv.Close()
+
+	q := testQueue(t, Config{Secret: "secret"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, gradientProcessor)
+
+	job, _ := q.Submit(Input{Image: []byte("#000000")}, srv.URL)
+
+	select {
+	case r := <-received:
+		if r.Header.Get("X-Job-ID") != job.ID {
+			t.Errorf("Expected job ID header")
+		}
+
+		if !Verify("secret", body, r.Header.Get("X-Signature")) {
+			t.Errorf("Expected valid signature, got %s", r.Header.Get("X-Signature"))
+		}
+
+		if Verify("other", body, r.Header.Get("X-Signature")) {
+			t.Errorf("Expected signature to depend on the secret")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Callback was not called")
+	}
+}
+
+func TestFileStoreResume(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := testQueue(t, Config{Store: store})
+	job, _ := q.Submit(Input{Image: []byte("#123456"), ImageType: "image/png"}, "")
+
+	loaded, err := store.Load(job.ID)
+	if err != nil || string(loaded.Input.Image) != "#123456" || loaded.Status != Queued {
+		t.Fatalf("Expected stored job with its image, got %+v, %v", loaded, err)
+	}
+
+	// A new queue on the same store picks the job up
+	restarted := testQueue(t, Config{Store: store})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go restarted.Run(ctx, gradientProcessor)
+
+	done := waitFor(t, restarted, job.ID, Done)
+	if done.Result.Gradient[0] != "#123456" {
+		t.Errorf("Expected resumed job result, got %+v", done.Result)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store := NewMemoryStore()
+	q := testQueue(t, Config{Store: store, Retention: time.Hour})
+
+	now := time.Now()
+	store.Save(&Job{ID: "00000000000000000000000000000001", Status: Done, UpdatedAt: now.Add(-2 * time.Hour)})
+	store.Save(&Job{ID: "00000000000000000000000000000002", Status: Done, UpdatedAt: now})
+	store.Save(&Job{ID: "00000000000000000000000000000003", Status: Queued, UpdatedAt: now.Add(-2 * time.Hour)})
+
+	if err := q.prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load("00000000000000000000000000000001"); err != ErrNotFound {
+		t.Errorf("Expected the expired job to be deleted, got %v", err)
+	}
+
+	for _, id := range []string{"00000000000000000000000000000002", "00000000000000000000000000000003"} {
+		if _, err := store.Load(id); err != nil {
+			t.Errorf("Expected job %s to be kept, got %v", id, err)
+		}
+	}
+}
+
+func TestResumeOverCapacity(t *testing.T) {
+	// Left by a stopped queue with a running job and a full queue
+	store := NewMemoryStore()
+	ids := []string{"00000000000000000000000000000001", "00000000000000000000000000000002", "00000000000000000000000000000003"}
+	for i, id := range ids {
+		status := Queued
+		if i == 0 {
+			status = Running
+		}
+		store.Save(&Job{ID: id, Status: status, Input: Input{Image: []byte("#00000" + id[31:])}})
+	}
+
+	q := testQueue(t, Config{Store: store, Workers: 1, QueueSize: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- q.Run(ctx, gradientProcessor) }()
+
+	for _, id := range ids {
+		job := waitFor(t, q, id, Done)
+		if job.Result.Gradient[0] != "#00000"+id[31:] {
+			t.Errorf("Expected the result of the stored image, got %+v", job.Result)
+		}
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected Run to keep going, got %v", err)
+	default:
+	}
+}
+
+func TestSubmitCapacity(t *testing.T) {
+	q := testQueue(t, Config{Workers: 1, QueueSize: 1})
+
+	// One running and one waiting job fit
+	for i := 0; i < 2; i++ {
+		if _, err := q.Submit(Input{}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := q.Submit(Input{}, ""); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestFileStoreList(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Save(&Job{ID: "00000000000000000000000000000001", Status: Queued, Input: Input{Image: []byte("image")}})
+	os.WriteFile(filepath.Join(dir, "00000000000000000000000000000002.json"), []byte("{"), 0o644)
+
+	jobs, err := store.List()
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected the readable job only, got %v %v", jobs, err)
+	}
+
+	if jobs[0].Input.Image != nil {
+		t.Errorf("Expected List to leave out the image")
+	}
+}
@@ -0,0 +1,222 @@
+package jobs
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/simonmarton/common-colors/logging"
+)
+
+// Store persists jobs so they survive restarts
+type Store interface {
+	// Save writes the job, the input image only has to be written the first time
+	Save(job *Job) error
+	// Load returns ErrNotFound for unknown jobs
+	Load(id string) (*Job, error)
+	// List returns every job without its input image
+	List() ([]*Job, error)
+	Delete(id string) error
+}
+
+// FileStore keeps every job in a JSON file of a directory with its input image next to it
+type FileStore struct {
+	dir    string
+	logger *slog.Logger
+}
+
+// NewFileStore creates a store in dir
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir, logger: logging.Discard}, nil
+}
+
+// WithLogger returns a copy of the store which logs the job files List skips
+func (s FileStore) WithLogger(logger *slog.Logger) *FileStore {
+	s.logger = logging.Or(logger)
+	return &s
+}
+
+// Save ...
+func (s *FileStore) Save(job *Job) error {
+	if len(job.Input.Image) > 0 {
+		p := filepath.Join(s.dir, job.ID+".image")
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			if err := writeFile(s.dir, p, job.Input.Image); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.dir, filepath.Join(s.dir, job.ID+".json"), data)
+}
+
+// Load ...
+func (s *FileStore) Load(id string) (*Job, error) {
+	job, err := s.loadJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := os.ReadFile(filepath.Join(s.dir, id+".image"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	job.Input.Image = image
+
+	return job, nil
+}
+
+// loadJob reads the JSON of a job without its image
+func (s *FileStore) loadJob(id string) (*Job, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// List skips the jobs which can't be read, one broken file doesn't block the rest
+func (s *FileStore) List() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Job
+	for _, e := range entries {
+		id := strings.TrimSuffix(e.Name(), ".json")
+		if id == e.Name() || !validID(id) {
+			continue
+		}
+
+		job, err := s.loadJob(id)
+		if err == ErrNotFound {
+			// Deleted since ReadDir
+			continue
+		}
+		if err != nil {
+			s.logger.Warn("Skipped unreadable job", "job_id", id, "error", err)
+			continue
+		}
+		result = append(result, job)
+	}
+
+	return result, nil
+}
+
+// Delete ...
+func (s *FileStore) Delete(id string) error {
+	os.Remove(filepath.Join(s.dir, id+".image"))
+
+	err := os.Remove(filepath.Join(s.dir, id+".json"))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// writeFile replaces the file through a temp file so a crash never leaves a partial job
+func writeFile(dir, path string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// MemoryStore keeps the jobs only in memory
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryStore ...
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string]Job{}}
+}
+
+// Save ...
+func (s *MemoryStore) Save(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *job
+	if prev, ok := s.jobs[job.ID]; ok && len(stored.Input.Image) == 0 {
+		stored.Input.Image = prev.Input.Image
+	}
+	s.jobs[job.ID] = stored
+
+	return nil
+}
+
+// Load ...
+func (s *MemoryStore) Load(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &job, nil
+}
+
+// List ...
+func (s *MemoryStore) List() ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []*Job
+	for _, job := range s.jobs {
+		job := withoutImage(job)
+		result = append(result, &job)
+	}
+
+	return result, nil
+}
+
+// Delete ...
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.jobs, id)
+
+	return nil
+}
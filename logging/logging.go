@@ -0,0 +1,80 @@
+// Package logging sets up slog loggers and carries them with the request ID in a context
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// Discard drops every record, libraries use it when no logger is given so they stay quiet
+var Discard = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// Or returns the logger or Discard if it's nil
+func Or(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return Discard
+	}
+
+	return logger
+}
+
+// New creates a logger writing to w, level is debug, info, warn or error and format is text or json
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("Invalid log level: %s", level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+
+	return nil, fmt.Errorf("Invalid log format: %s", format)
+}
+
+// WithRequestID stores the ID of the request in the context and adds it to the logger of the context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey, id)
+	return NewContext(ctx, FromContext(ctx).With("request_id", id))
+}
+
+// RequestID of the context, empty if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// NewContext stores the logger in the context
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger of the context or Discard
+func FromContext(ctx context.Context) *slog.Logger {
+	logger, _ := ctx.Value(loggerKey).(*slog.Logger)
+	return Or(logger)
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "debug", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestID(NewContext(context.Background(), logger), "abc")
+	if RequestID(ctx) != "abc" {
+		t.Errorf("Expected request ID abc, got %s", RequestID(ctx))
+	}
+
+	FromContext(ctx).Debug("Processing")
+	if !strings.Contains(buf.String(), `"request_id":"abc"`) {
+		t.Errorf("Expected request ID in the log, got %s", buf.String())
+	}
+}
+
+func TestQuietByDefault(t *testing.T) {
+	if FromContext(context.Background()) != Discard || Or(nil) != Discard {
+		t.Errorf("Expected Discard without a logger")
+	}
+
+	if Discard.Enabled(context.Background(), 12) {
+		t.Errorf("Expected Discard to be disabled")
+	}
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("Expected only warnings, got %s", buf.String())
+	}
+
+	if _, err := New(&buf, "loud", ""); err == nil {
+		t.Errorf("Expected invalid level error")
+	}
+
+	if _, err := New(&buf, "", "xml"); err == nil {
+		t.Errorf("Expected invalid format error")
+	}
+}
@@ -1,11 +1,36 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/simonmarton/common-colors/server"
 )
 
 func main() {
 	h := ProcessHandler{}
 
-	server.Initialize(h)
+	config, err := server.LoadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	s, err := server.New(h, config)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Kubernetes sends SIGTERM before killing the pod, the running requests are drained
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if err := s.Run(ctx); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
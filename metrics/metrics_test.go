@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.Counter("requests_total", "Handled requests.", "route", "code")
+	c.Inc("/api/upload", "200")
+	c.Inc("/api/upload", "200")
+	c.Add(3, `/a"b`, "500")
+
+	h := r.Histogram("duration_seconds", "Request latency.", []float64{.1, 1}, "route")
+	h.Observe(.05, "/api/upload")
+	h.Observe(.5, "/api/upload")
+	h.Observe(5, "/api/upload")
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP requests_total Handled requests.
+# TYPE requests_total counter
+requests_total{route="/a\"b",code="500"} 3
+requests_total{route="/api/upload",code="200"} 2
+# HELP duration_seconds Request latency.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/api/upload",le="0.1"} 1
+duration_seconds_bucket{route="/api/upload",le="1"} 2
+duration_seconds_bucket{route="/api/upload",le="+Inf"} 3
+duration_seconds_sum{route="/api/upload"} 5.55
+duration_seconds_count{route="/api/upload"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("WriteText error, expected\n%s\ngot\n%s", expected, buf.String())
+	}
+
+	if c.Value("/api/upload", "200") != 2 || h.Count("/api/upload") != 3 {
+		t.Errorf("Expected the recorded values")
+	}
+}
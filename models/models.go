@@ -1,5 +1,7 @@
 package models
 
+import "image"
+
 // CalculatorConfig defines the parameters for the calculator to use
 type CalculatorConfig struct {
 	TransparencyTreshold uint8   `json:"transparencyTreshold"`
@@ -9,4 +11,62 @@ type CalculatorConfig struct {
 	DistanceThreshold    float64 `json:"distanceThreshold"`
 	MinSaturation        float64 `json:"minSaturation"`
 	Algorithm            string  `json:"algorithm"`
+	AlphaWeighted        bool    `json:"alphaWeighted"`
+	Background           string  `json:"background"`
+	Sampling             string  `json:"sampling"`
+	PixelBudget          int     `json:"pixelBudget"`
+	ResizeFilter         string  `json:"resizeFilter"`
+	Seed                 int64   `json:"seed"`
+	BackgroundRemoval    string  `json:"backgroundRemoval"`
+	BackgroundTolerance  float64 `json:"backgroundTolerance"`
+	BackgroundWeight     float64 `json:"backgroundWeight"`
+	SpatialWeighting     string  `json:"spatialWeighting"`
+	CenterSigma          float64 `json:"centerSigma"`
+}
+
+// Point on an image in pixels, relative to its top left corner
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Rect on an image in pixels, relative to its top left corner
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Selection limits which pixels of an image are used for the calculation,
+// when more of them are set only the pixels selected by all of them are used
+type Selection struct {
+	Rect *Rect `json:"rect"`
+	// A pixel is selected if its center is inside any of the polygons
+	Polygons [][]Point `json:"polygons"`
+	// Lighter pixels of the mask are weighted more, black or transparent ones are ignored
+	Mask image.Image `json:"-"`
+}
+
+// CommonColorsResp format
+type CommonColorsResp struct {
+	Colors   []ColorResp `json:"colors"`
+	Gradient []string    `json:"gradient"`
+	// StepsOfColors is only set when the steps were requested
+	StepsOfColors [][]ColorStepResp `json:"steps,omitempty"`
+}
+
+// ColorResp ...
+type ColorResp struct {
+	Weight      float64 `json:"weight"`
+	Value       string  `json:"value"`
+	HueDistance float64 `json:"hueDistance"`
+}
+
+// ColorStepResp ...
+type ColorStepResp struct {
+	R      uint8   `json:"r"`
+	G      uint8   `json:"g"`
+	B      uint8   `json:"b"`
+	Weight float64 `json:"weight"`
 }
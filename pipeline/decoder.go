@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+)
+
+// ImageDecoder decodes PNG and JPEG images by MIME type or file extension,
+// JPEGs which fail to decode are retried as PNG as some servers mislabel them
+type ImageDecoder struct{}
+
+// Decode ...
+func (d ImageDecoder) Decode(file io.Reader, imageType string) (image.Image, error) {
+	var img image.Image
+	var err error
+
+	// save original bytes for the future
+	originalBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	file = ioutil.NopCloser(bytes.NewReader(originalBytes)) // reset file stream
+
+	switch imageType {
+	case ".jpg":
+		fallthrough
+	case ".jpeg":
+		fallthrough
+	case "image/jpg":
+		fallthrough
+	case "image/jpeg":
+		img, err = jpeg.Decode(file)
+		if err != nil {
+			file = ioutil.NopCloser(bytes.NewReader(originalBytes)) // reset file stream
+			img, err = png.Decode(file)
+			if err != nil {
+				return nil, &DecodeError{Err: err}
+			}
+		}
+	case ".png":
+		fallthrough
+	case "image/png":
+		img, err = png.Decode(file)
+		if err != nil {
+			return nil, &DecodeError{Err: err}
+		}
+	default:
+		return nil, &UnsupportedFormatError{Format: imageType}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrAllFiltered is returned when no color is left to cluster
+var ErrAllFiltered = errors.New("All colors were filtered")
+
+// ErrDecodeTimeout is returned when decoding takes longer than Limits.DecodeTimeout
+var ErrDecodeTimeout = errors.New("Decoding the image timed out")
+
+// LimitError is returned for images over one of the Limits, before they are decoded
+type LimitError struct {
+	// Limit is "pixels" or "frames"
+	Limit string
+	Value int64
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Image has %d %s, the limit is %d", e.Value, e.Limit, e.Max)
+}
+
+// UnsupportedFormatError is returned for image types the decoder can't handle
+type UnsupportedFormatError struct {
+	Format string
+}
+
+func (e *UnsupportedFormatError) Error() string {
+	return fmt.Sprintf("Not supported image format: %s", e.Format)
+}
+
+// DecodeError is returned when an image of a supported format is broken
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Invalid image: %v", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// SelectionError is returned by ValidateSelection for a selection which can't be used
+type SelectionError struct {
+	Message string
+}
+
+func (e *SelectionError) Error() string {
+	return "Invalid selection: " + e.Message
+}
+
+// ConfigError is returned by Validate for a value of the config which isn't supported
+type ConfigError struct {
+	// Key is the JSON key of the field
+	Key     string
+	Value   string
+	Allowed []string
+	// Err is why a value which isn't one of a list can't be parsed
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Invalid %s %q: %v", e.Key, e.Value, e.Err)
+	}
+
+	return fmt.Sprintf("Not supported %s %q, expected one of %s", e.Key, e.Value, strings.Join(e.Allowed, ", "))
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"time"
+
+	"github.com/simonmarton/common-colors/models"
+)
+
+const (
+	// DefaultMaxPixels allows 25 megapixels, about 100MB decoded
+	DefaultMaxPixels     = 25000000
+	DefaultMaxFrames     = 100
+	DefaultDecodeTimeout = 10 * time.Second
+	// DefaultMaxPixelBudget keeps clustering, which is O(pixels * clusters), within a second or so
+	DefaultMaxPixelBudget = 256 * 256
+)
+
+// Limits protect the decoder against images which would take too much memory or time,
+// e.g. a small PNG declaring 50000x50000 pixels, zero fields use the defaults
+type Limits struct {
+	MaxPixels     int
+	MaxFrames     int
+	DecodeTimeout time.Duration
+	// MaxPixelBudget is the most pixels sampled for clustering, whatever the config asks for.
+	// Unlike the others it's off if zero, so library callers get the sampling they ask for,
+	// servers should set it, e.g. to DefaultMaxPixelBudget.
+	MaxPixelBudget int
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxPixels <= 0 {
+		l.MaxPixels = DefaultMaxPixels
+	}
+
+	if l.MaxFrames <= 0 {
+		l.MaxFrames = DefaultMaxFrames
+	}
+
+	if l.DecodeTimeout <= 0 {
+		l.DecodeTimeout = DefaultDecodeTimeout
+	}
+
+	return l
+}
+
+// Apply clamps the pixel budget of a config to MaxPixelBudget. Sampling "none" is replaced with
+// resizing to MaxPixelBudget, which keeps every pixel of the images within it.
+// The config is returned as it is without a MaxPixelBudget.
+func (l Limits) Apply(c models.CalculatorConfig) models.CalculatorConfig {
+	if l.MaxPixelBudget <= 0 {
+		return c
+	}
+
+	if c.Sampling == "none" {
+		c.Sampling = "resize"
+		c.PixelBudget = l.MaxPixelBudget
+	}
+
+	if c.PixelBudget > l.MaxPixelBudget {
+		c.PixelBudget = l.MaxPixelBudget
+	}
+
+	return c
+}
+
+// Check reads the header of an image and fails if it's over the limits before anything is allocated for
+// its pixels, images which can't be recognized pass as the decoder reports them
+func (l Limits) Check(data []byte) error {
+	l = l.withDefaults()
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	if pixels := int64(config.Width) * int64(config.Height); pixels > int64(l.MaxPixels) {
+		return &LimitError{Limit: "pixels", Value: pixels, Max: int64(l.MaxPixels)}
+	}
+
+	if frames := pngFrames(data); frames > int64(l.MaxFrames) {
+		return &LimitError{Limit: "frames", Value: frames, Max: int64(l.MaxFrames)}
+	}
+
+	return nil
+}
+
+// decode runs the decoder with the timeout, it keeps running in the background after
+// a timeout but its memory use is bounded by Check
+func (l Limits) decode(decode func() (image.Image, error)) (image.Image, error) {
+	type result struct {
+		img image.Image
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		img, err := decode()
+		done <- result{img, err}
+	}()
+
+	timer := time.NewTimer(l.withDefaults().DecodeTimeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.img, r.err
+	case <-timer.C:
+		return nil, ErrDecodeTimeout
+	}
+}
+
+// pngFrames is the frame count in the acTL chunk of an animated PNG, 1 for every other image
+func pngFrames(data []byte) int64 {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return 1
+	}
+
+	// Chunks are a 4 byte length, 4 byte type, the data and a 4 byte CRC,
+	// acTL has to come before the image data
+	for p := len(signature); p+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[p:]))
+		chunk := string(data[p+4 : p+8])
+
+		switch {
+		case chunk == "acTL" && length >= 4 && p+12 <= len(data):
+			return int64(binary.BigEndian.Uint32(data[p+8:]))
+		case chunk == "IDAT", length < 0 || length > len(data):
+			return 1
+		}
+
+		p += 12 + length
+	}
+
+	return 1
+}
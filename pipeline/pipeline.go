@@ -0,0 +1,364 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/simonmarton/common-colors/background"
+	"github.com/simonmarton/common-colors/calculator"
+	"github.com/simonmarton/common-colors/color"
+	"github.com/simonmarton/common-colors/logging"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/sampler"
+	"github.com/simonmarton/common-colors/spatial"
+)
+
+// Decoder turns the bytes of an image into an image.Image,
+// imageType is either a MIME type or a file extension
+type Decoder interface {
+	Decode(file io.Reader, imageType string) (image.Image, error)
+}
+
+// Sampler picks the colors of an image limited to the selection
+type Sampler interface {
+	Sample(img image.Image, selection models.Selection) []color.Color
+}
+
+// Filter drops the colors which shouldn't be part of the result
+type Filter interface {
+	Filter(colors []color.Color) []color.Color
+}
+
+// Clusterer groups similar colors, steps are the intermediate results for visualization
+type Clusterer interface {
+	Cluster(colors []color.Color) (clusters []color.Color, steps [][]color.Color, err error)
+}
+
+// StepClusterer is a Clusterer which can report every step as soon as it's done
+type StepClusterer interface {
+	Clusterer
+	ClusterSteps(colors []color.Color, onStep func([]color.Color)) ([]color.Color, error)
+}
+
+// Ranker orders the clusters, the first one is the main color
+type Ranker interface {
+	Rank(colors []color.Color) []color.Color
+}
+
+// Gradient picks the gradient colors from the ranked clusters
+type Gradient interface {
+	Gradient(colors []color.Color) []string
+}
+
+// FilterFunc adapts a function to a Filter
+type FilterFunc func(colors []color.Color) []color.Color
+
+// Filter ...
+func (f FilterFunc) Filter(colors []color.Color) []color.Color { return f(colors) }
+
+// ClustererFunc adapts a function to a Clusterer
+type ClustererFunc func(colors []color.Color) ([]color.Color, [][]color.Color, error)
+
+// Cluster ...
+func (f ClustererFunc) Cluster(colors []color.Color) ([]color.Color, [][]color.Color, error) {
+	return f(colors)
+}
+
+// RankerFunc adapts a function to a Ranker
+type RankerFunc func(colors []color.Color) []color.Color
+
+// Rank ...
+func (f RankerFunc) Rank(colors []color.Color) []color.Color { return f(colors) }
+
+// GradientFunc adapts a function to a Gradient
+type GradientFunc func(colors []color.Color) []string
+
+// Gradient ...
+func (f GradientFunc) Gradient(colors []color.Color) []string { return f(colors) }
+
+// Options of processing an image besides the calculator config
+type Options struct {
+	Selection models.Selection
+	// WithSteps includes the colors of every clustering iteration in the result
+	WithSteps bool
+	// OnStep is called with the sampled, filtered and every clustering step as they complete
+	OnStep func(step []models.ColorStepResp) `json:"-"`
+	// Observer is told about the input and the duration of every stage
+	Observer Observer `json:"-"`
+	// Logger gets the progress at debug level, nothing is logged if nil
+	Logger *slog.Logger `json:"-"`
+	// Limits of the image decoded by RunReader
+	Limits Limits `json:"-"`
+}
+
+// Observer is notified about a run, e.g. to collect metrics
+type Observer interface {
+	// Input is called before decoding with the normalized format ("png", "jpeg" or "other") and the size in bytes
+	Input(format string, size int)
+	// Stage is called after each of decode, resize, filter, cluster, rank and gradient.
+	// resize is the Sampler, named after the default sampling which downsizes the image to the pixel budget,
+	// the names are metric labels and don't change with the sampling.
+	Stage(name string, d time.Duration)
+}
+
+// Pipeline calculates the common colors of an image in stages:
+// decoder → sampler → filter → clusterer → ranker → gradient,
+// any of them can be replaced after New
+type Pipeline struct {
+	Decoder   Decoder
+	Sampler   Sampler
+	Filter    Filter
+	Clusterer Clusterer
+	Ranker    Ranker
+	Gradient  Gradient
+}
+
+// New creates a Pipeline with the default stages set up from the config
+func New(config models.CalculatorConfig) *Pipeline {
+	calc := calculator.New(config)
+
+	return &Pipeline{
+		Decoder:   ImageDecoder{},
+		Sampler:   MaskedSampler{Config: config},
+		Filter:    FilterFunc(calc.RemoveInvalidColors),
+		Clusterer: calc,
+		Ranker:    RankerFunc(color.Sort),
+		Gradient:  GradientFunc(calc.GenrateGradientColors),
+	}
+}
+
+// Normalize applies the defaults of the default stages,
+// configs which normalize to the same value give the same result
+func Normalize(config models.CalculatorConfig) models.CalculatorConfig {
+	return sampler.WithDefaults(calculator.New(config).Config())
+}
+
+// ConfigValues are the values of the string fields of the config supported by the default stages,
+// by JSON key, an empty string uses the default
+var ConfigValues = map[string][]string{
+	"algorithm":         {"simple", "yiq"},
+	"sampling":          {"resize", "grid", "random", "none"},
+	"resizeFilter":      {"nearest", "box", "bilinear", "lanczos"},
+	"backgroundRemoval": {"floodfill", "frame"},
+	"spatialWeighting":  {"center", "edge", "saliency"},
+}
+
+// Validate checks the string fields of a config against ConfigValues and parses the background color
+func Validate(c models.CalculatorConfig) error {
+	fields := []struct{ key, value string }{
+		{"algorithm", c.Algorithm},
+		{"sampling", c.Sampling},
+		{"resizeFilter", c.ResizeFilter},
+		{"backgroundRemoval", c.BackgroundRemoval},
+		{"spatialWeighting", c.SpatialWeighting},
+	}
+
+	for _, f := range fields {
+		if f.value != "" && !slices.Contains(ConfigValues[f.key], f.value) {
+			return &ConfigError{Key: f.key, Value: f.value, Allowed: ConfigValues[f.key]}
+		}
+	}
+
+	// The calculator would ignore it without compositing
+	if c.Background != "" {
+		if _, err := color.NewFromHex(c.Background); err != nil {
+			return &ConfigError{Key: "background", Value: c.Background, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// Limits of a selection, every pixel of the selected area is tested against the polygons
+const (
+	MaxPolygons      = 64
+	MaxPolygonPoints = 4096
+)
+
+// ValidateSelection rejects a rect without a positive size and more than MaxPolygons polygons
+// or MaxPolygonPoints points of them in total
+func ValidateSelection(s models.Selection) error {
+	if s.Rect != nil && (s.Rect.Width <= 0 || s.Rect.Height <= 0) {
+		return &SelectionError{Message: fmt.Sprintf("rect size %dx%d is not positive", s.Rect.Width, s.Rect.Height)}
+	}
+
+	if len(s.Polygons) > MaxPolygons {
+		return &SelectionError{Message: fmt.Sprintf("%d polygons, the limit is %d", len(s.Polygons), MaxPolygons)}
+	}
+
+	points := 0
+	for _, polygon := range s.Polygons {
+		points += len(polygon)
+	}
+
+	if points > MaxPolygonPoints {
+		return &SelectionError{Message: fmt.Sprintf("%d polygon points, the limit is %d", points, MaxPolygonPoints)}
+	}
+
+	return nil
+}
+
+// RunReader decodes the image within opts.Limits and runs the rest of the stages on it
+func (p *Pipeline) RunReader(file io.Reader, imageType string, opts Options) (models.CommonColorsResp, error) {
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return models.CommonColorsResp{}, err
+	}
+
+	if opts.Observer != nil {
+		opts.Observer.Input(Format(imageType), len(body))
+	}
+
+	if err := opts.Limits.Check(body); err != nil {
+		return models.CommonColorsResp{}, err
+	}
+
+	done := opts.stage("decode")
+	img, err := opts.Limits.decode(func() (image.Image, error) {
+		return p.Decoder.Decode(bytes.NewReader(body), imageType)
+	})
+	done()
+	if err != nil {
+		return models.CommonColorsResp{}, err
+	}
+
+	return p.Run(img, opts)
+}
+
+// Run every stage after decoding on an image
+func (p *Pipeline) Run(img image.Image, opts Options) (result models.CommonColorsResp, err error) {
+	if err := ValidateSelection(opts.Selection); err != nil {
+		return models.CommonColorsResp{}, err
+	}
+
+	var steps [][]models.ColorStepResp
+	addStep := func(colors []color.Color) {
+		if !opts.WithSteps && opts.OnStep == nil {
+			return
+		}
+
+		step := stepResp(colors)
+		steps = append(steps, step)
+		if opts.OnStep != nil {
+			opts.OnStep(step)
+		}
+	}
+
+	logger := logging.Or(opts.Logger)
+
+	done := opts.stage("resize")
+	colors := p.Sampler.Sample(img, opts.Selection)
+	done()
+	addStep(colors)
+	logger.Debug("Sampled colors", "count", len(colors), "width", img.Bounds().Dx(), "height", img.Bounds().Dy())
+
+	done = opts.stage("filter")
+	colors = p.Filter.Filter(colors)
+	done()
+	addStep(colors)
+	logger.Debug("Filtered colors", "count", len(colors))
+
+	done = opts.stage("cluster")
+	if c, ok := p.Clusterer.(StepClusterer); ok {
+		colors, err = c.ClusterSteps(colors, addStep)
+	} else {
+		var clusterSteps [][]color.Color
+		colors, clusterSteps, err = p.Clusterer.Cluster(colors)
+		for _, cs := range clusterSteps {
+			addStep(cs)
+		}
+	}
+	done()
+	if err != nil {
+		return models.CommonColorsResp{}, err
+	}
+
+	logger.Debug("Clustered colors", "count", len(colors))
+
+	done = opts.stage("rank")
+	colors = p.Ranker.Rank(colors)
+	done()
+	if len(colors) == 0 {
+		return models.CommonColorsResp{}, ErrAllFiltered
+	}
+
+	mainColor := colors[0]
+	for _, c := range colors {
+		result.Colors = append(result.Colors, models.ColorResp{
+			Value:       c.ToHex(),
+			Weight:      c.Weight,
+			HueDistance: math.Abs(mainColor.Hue() - c.Hue()),
+		})
+	}
+
+	if opts.WithSteps {
+		result.StepsOfColors = steps
+	}
+
+	done = opts.stage("gradient")
+	result.Gradient = p.Gradient.Gradient(colors)
+	done()
+
+	return result, nil
+}
+
+// stage starts timing a stage, the returned function reports it to the Observer
+func (opts Options) stage(name string) func() {
+	if opts.Observer == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		opts.Observer.Stage(name, time.Since(start))
+	}
+}
+
+// Format normalizes a MIME type or file extension to "png", "jpeg" or "other"
+func Format(imageType string) string {
+	switch imageType {
+	case "image/png", ".png":
+		return "png"
+	case "image/jpeg", "image/jpg", ".jpeg", ".jpg":
+		return "jpeg"
+	}
+
+	return "other"
+}
+
+func stepResp(colors []color.Color) []models.ColorStepResp {
+	r := []models.ColorStepResp{}
+	for _, c := range colors {
+		r = append(r, models.ColorStepResp{
+			R:      c.R,
+			G:      c.G,
+			B:      c.B,
+			Weight: c.Weight,
+		})
+	}
+
+	return r
+}
+
+// MaskedSampler combines the selection with the background and spatial weights of the config
+// and samples the image with the configured strategy
+type MaskedSampler struct {
+	Config models.CalculatorConfig
+}
+
+// Sample ...
+func (s MaskedSampler) Sample(img image.Image, selection models.Selection) []color.Color {
+	mask := sampler.NewMask(selection, img.Bounds())
+	if bg := background.Detect(img, s.Config); bg != nil {
+		mask = sampler.Intersect(mask, bg)
+	}
+	mask = sampler.Intersect(mask, spatial.New(img, s.Config))
+
+	return sampler.New(s.Config).Sample(img, mask)
+}
@@ -0,0 +1,342 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	imagecolor "image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonmarton/common-colors/calculator"
+	"github.com/simonmarton/common-colors/color"
+	"github.com/simonmarton/common-colors/models"
+)
+
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			c := imagecolor.NRGBA{R: 220, G: 40, B: 40, A: 255}
+			if x >= 6 {
+				c = imagecolor.NRGBA{R: 40, G: 40, B: 220, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func pngBytes(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestImageDecoder(t *testing.T) {
+	var decodeTests = []struct {
+		imageType string
+		valid     bool
+	}{
+		{"image/png", true},
+		{".png", true},
+		// Mislabeled PNG
+		{"image/jpeg", true},
+		{".jpg", true},
+		{"image/gif", false},
+	}
+
+	for _, tt := range decodeTests {
+		img, err := ImageDecoder{}.Decode(bytes.NewReader(pngBytes(t)), tt.imageType)
+		if tt.valid && (err != nil || img.Bounds().Dx() != 8) {
+			t.Errorf("Expected %s to decode, got %v", tt.imageType, err)
+		}
+
+		if !tt.valid && err == nil {
+			t.Errorf("Expected %s to fail", tt.imageType)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	config := models.CalculatorConfig{IterationCount: 3, MinSaturation: 0}
+	result, err := New(config).RunReader(bytes.NewReader(pngBytes(t)), "image/png", Options{WithSteps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Colors) != 2 || result.Colors[0].Value != "#dc2828" || result.Colors[0].Weight != 48 {
+		t.Errorf("Expected red main color, got %+v", result.Colors)
+	}
+
+	// Sampled, filtered and every iteration
+	if result.StepsOfColors == nil || len(result.StepsOfColors) != 5 {
+		t.Errorf("Expected 5 steps")
+	}
+}
+
+func TestRunCustomStages(t *testing.T) {
+	p := New(models.CalculatorConfig{MinSaturation: 0})
+	p.Ranker = RankerFunc(func(colors []color.Color) []color.Color {
+		// Lightest weight first
+		for i, j := 0, len(colors)-1; i < j; i, j = i+1, j-1 {
+			colors[i], colors[j] = colors[j], colors[i]
+		}
+		return colors
+	})
+	p.Gradient = GradientFunc(func(colors []color.Color) []string {
+		return []string{colors[0].ToHex()}
+	})
+
+	result, err := p.Run(testImage(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Gradient) != 1 || result.Gradient[0] != "#2828dc" {
+		t.Errorf("Expected custom stages to be used, got %v", result.Gradient)
+	}
+
+	if result.StepsOfColors != nil {
+		t.Errorf("Expected no steps")
+	}
+}
+
+func TestRunAllFiltered(t *testing.T) {
+	p := New(models.CalculatorConfig{})
+	p.Filter = FilterFunc(func(colors []color.Color) []color.Color { return nil })
+
+	if _, err := p.Run(testImage(), Options{}); err != ErrAllFiltered {
+		t.Errorf("Expected ErrAllFiltered when every color is filtered, got %v", err)
+	}
+}
+
+func TestRunOnStep(t *testing.T) {
+	var steps int
+	opts := Options{OnStep: func(step []models.ColorStepResp) { steps++ }}
+
+	result, err := New(models.CalculatorConfig{IterationCount: 3}).Run(testImage(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if steps != 5 {
+		t.Errorf("Expected 5 steps reported, got %d", steps)
+	}
+
+	if result.StepsOfColors != nil {
+		t.Errorf("Expected no steps in the result")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, err := New(models.CalculatorConfig{}).RunReader(bytes.NewReader(pngBytes(t)), "image/gif", Options{})
+	var unsupported *UnsupportedFormatError
+	if !errors.As(err, &unsupported) || unsupported.Format != "image/gif" {
+		t.Errorf("Expected UnsupportedFormatError, got %v", err)
+	}
+
+	_, err = New(models.CalculatorConfig{}).RunReader(bytes.NewReader([]byte("broken")), "image/png", Options{})
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Expected DecodeError, got %v", err)
+	}
+}
+
+type recordingObserver struct {
+	format string
+	size   int
+	stages []string
+}
+
+func (o *recordingObserver) Input(format string, size int) {
+	o.format, o.size = format, size
+}
+
+func (o *recordingObserver) Stage(name string, d time.Duration) {
+	o.stages = append(o.stages, name)
+}
+
+func TestObserver(t *testing.T) {
+	o := &recordingObserver{}
+	body := pngBytes(t)
+
+	if _, err := New(models.CalculatorConfig{}).RunReader(bytes.NewReader(body), ".png", Options{Observer: o}); err != nil {
+		t.Fatal(err)
+	}
+
+	if o.format != "png" || o.size != len(body) {
+		t.Errorf("Expected png input of %d bytes, got %s %d", len(body), o.format, o.size)
+	}
+
+	if strings.Join(o.stages, ",") != "decode,resize,filter,cluster,rank,gradient" {
+		t.Errorf("Expected every stage, got %v", o.stages)
+	}
+}
+
+// pngHeader is the start of a PNG declaring the size, with extra chunks before the image data
+func pngHeader(width, height uint32, chunks ...[]byte) []byte {
+	chunk := func(name string, data []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		b = append(b, name...)
+		b = append(b, data...)
+		return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(append([]byte(name), data...)))
+	}
+
+	ihdr := binary.BigEndian.AppendUint32(nil, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	b := append([]byte("\x89PNG\r\n\x1a\n"), chunk("IHDR", ihdr)...)
+	for _, c := range chunks {
+		b = append(b, chunk(string(c[:4]), c[4:])...)
+	}
+
+	return b
+}
+
+type slowDecoder struct{}
+
+func (d slowDecoder) Decode(file io.Reader, imageType string) (image.Image, error) {
+	time.Sleep(time.Second)
+	return testImage(), nil
+}
+
+func TestLimits(t *testing.T) {
+	actl := append([]byte("acTL"), 0, 0, 3, 232, 0, 0, 0, 0)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		limit  string
+	}{
+		{"bomb", pngHeader(50000, 50000), Limits{}, "pixels"},
+		{"over max pixels", pngBytes(t), Limits{MaxPixels: 63}, "pixels"},
+		{"frames", pngHeader(8, 8, actl), Limits{}, "frames"},
+		{"within limits", pngBytes(t), Limits{MaxPixels: 64, MaxFrames: 1}, ""},
+		{"not an image", []byte("broken"), Limits{MaxPixels: 1}, ""},
+	}
+
+	for _, test := range tests {
+		err := test.limits.Check(test.data)
+
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) != (test.limit != "") || test.limit != "" && limitErr.Limit != test.limit {
+			t.Errorf("Check %s error, expected %q limit, got %v", test.name, test.limit, err)
+		}
+	}
+
+	_, err := New(models.CalculatorConfig{}).RunReader(bytes.NewReader(pngHeader(50000, 50000)), "image/png", Options{})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Errorf("Expected RunReader to check the limits, got %v", err)
+	}
+
+	p := New(models.CalculatorConfig{})
+	p.Decoder = slowDecoder{}
+	_, err = p.RunReader(bytes.NewReader(pngBytes(t)), "image/png", Options{Limits: Limits{DecodeTimeout: 10 * time.Millisecond}})
+	if err != ErrDecodeTimeout {
+		t.Errorf("Expected ErrDecodeTimeout, got %v", err)
+	}
+}
+
+func TestLimitsApply(t *testing.T) {
+	limits := Limits{MaxPixelBudget: 100}
+
+	tests := []struct {
+		name     string
+		config   models.CalculatorConfig
+		sampling string
+		budget   int
+	}{
+		{"default", models.CalculatorConfig{}, "", 0},
+		{"within", models.CalculatorConfig{Sampling: "grid", PixelBudget: 50}, "grid", 50},
+		{"over", models.CalculatorConfig{Sampling: "random", PixelBudget: 1000000}, "random", 100},
+		{"none", models.CalculatorConfig{Sampling: "none"}, "resize", 100},
+	}
+
+	for _, test := range tests {
+		got := limits.Apply(test.config)
+		if got.Sampling != test.sampling || got.PixelBudget != test.budget {
+			t.Errorf("Apply %s, expected %q sampling with %d pixels, got %q with %d", test.name, test.sampling, test.budget, got.Sampling, got.PixelBudget)
+		}
+	}
+
+	// Library callers without a limit get what they asked for
+	unlimited := models.CalculatorConfig{Sampling: "none", PixelBudget: 1 << 30}
+	if got := (Limits{}).Apply(unlimited); got != unlimited {
+		t.Errorf("Expected the config to be kept without a max pixel budget, got %+v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		config models.CalculatorConfig
+		key    string
+	}{
+		{models.CalculatorConfig{}, ""},
+		{models.CalculatorConfig{Algorithm: "yiq", Sampling: "none", ResizeFilter: "box", BackgroundRemoval: "frame", SpatialWeighting: "edge"}, ""},
+		{models.CalculatorConfig{Algorithm: "nope"}, "algorithm"},
+		{models.CalculatorConfig{Sampling: "all"}, "sampling"},
+		{models.CalculatorConfig{ResizeFilter: "cubic"}, "resizeFilter"},
+		{models.CalculatorConfig{BackgroundRemoval: "auto"}, "backgroundRemoval"},
+		{models.CalculatorConfig{SpatialWeighting: "faces"}, "spatialWeighting"},
+		{models.CalculatorConfig{Background: "#fff"}, ""},
+		{models.CalculatorConfig{Background: "red"}, "background"},
+	}
+
+	for _, test := range tests {
+		err := Validate(test.config)
+
+		var configErr *ConfigError
+		if errors.As(err, &configErr) != (test.key != "") || test.key != "" && configErr.Key != test.key {
+			t.Errorf("Validate %+v, expected %q error, got %v", test.config, test.key, err)
+		}
+	}
+
+	_, err := New(models.CalculatorConfig{Algorithm: "nope"}).Run(testImage(), Options{})
+	if !errors.Is(err, calculator.ErrUnsupportedAlgorithm) {
+		t.Errorf("Expected Run to return the clustering error, got %v", err)
+	}
+}
+
+func TestValidateSelection(t *testing.T) {
+	square := []models.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}}
+
+	tests := []struct {
+		selection models.Selection
+		valid     bool
+	}{
+		{models.Selection{}, true},
+		{models.Selection{Rect: &models.Rect{Width: 1, Height: 1}, Polygons: [][]models.Point{square}}, true},
+		{models.Selection{Rect: &models.Rect{X: 5, Width: -3, Height: 2}}, false},
+		{models.Selection{Rect: &models.Rect{Width: 3}}, false},
+		{models.Selection{Polygons: make([][]models.Point, MaxPolygons+1)}, false},
+		{models.Selection{Polygons: [][]models.Point{make([]models.Point, MaxPolygonPoints+1)}}, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateSelection(test.selection)
+
+		var selectionErr *SelectionError
+		if errors.As(err, &selectionErr) == test.valid {
+			t.Errorf("ValidateSelection %+v, expected valid %v, got %v", test.selection, test.valid, err)
+		}
+	}
+
+	_, err := New(models.CalculatorConfig{}).Run(testImage(), Options{Selection: models.Selection{Rect: &models.Rect{}}})
+	var selectionErr *SelectionError
+	if !errors.As(err, &selectionErr) {
+		t.Errorf("Expected Run to reject the selection, got %v", err)
+	}
+}
@@ -1,120 +1,44 @@
 package main
 
 import (
-	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
+	"context"
 	"io"
-	"math"
 
-	"github.com/nfnt/resize"
-	"github.com/simonmarton/common-colors/calculator"
-	"github.com/simonmarton/common-colors/color"
+	"github.com/simonmarton/common-colors/logging"
 	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/processimage"
 	"github.com/simonmarton/common-colors/server"
 )
 
 // ProcessHandler ...
 type ProcessHandler struct {
-	calculator *calculator.Calculator
+	// Fetcher downloads the URLs, processimage.DefaultFetcher if nil
+	Fetcher *processimage.Fetcher
 }
 
-// ProcessImage ...
-func (h ProcessHandler) ProcessImage(file io.Reader, imageType string, config models.CalculatorConfig, withSteps bool) (result server.CommonColorsResp, err error) {
-	fmt.Printf("Processing image with config %+v\n", config)
-
-	h.calculator = calculator.New(config)
-
-	img, err := openImage(file, imageType)
-	if err != nil {
-		return server.CommonColorsResp{}, err
-	}
-
-	// img = resizeImage(img, 64, 64)
-	img = resizeImage(img, 32, 32)
-	colors := colorsFromImage(img)
-
-	colors, steps := h.calculator.GetCommonColors(colors)
-	mainColor := colors[0]
-	for _, c := range colors {
-		result.Colors = append(result.Colors, server.ColorResp{
-			Value:       c.ToHex(),
-			Weight:      c.Weight,
-			HueDistance: math.Abs(mainColor.Hue() - c.Hue()),
-		})
-	}
-
-	if withSteps {
-		var stepsOfColors [][]server.ColorStepResp
-		for _, cs := range steps {
-			r := []server.ColorStepResp{}
-			for _, c := range cs {
-				r = append(r, server.ColorStepResp{
-					R:      c.R,
-					G:      c.G,
-					B:      c.B,
-					Weight: c.Weight,
-				})
-			}
-			stepsOfColors = append(stepsOfColors, r)
-		}
-
-		result.StepsOfColors = &stepsOfColors
-	}
-
-	result.Gradient = h.calculator.GenrateGradientColors(colors)
-
-	return result, nil
-}
-
-func resizeImage(img image.Image, width, height int) image.Image {
-	bounds := img.Bounds()
-
-	if bounds.Dx() > width || bounds.Dy() > height {
-		return resize.Resize(uint(width), uint(height), img, resize.Lanczos3)
-	}
-
-	return img
+// WithFetcher returns a handler downloading with the fetcher configured by the server
+func (h ProcessHandler) WithFetcher(f *processimage.Fetcher) server.APIHandler {
+	h.Fetcher = f
+	return h
 }
 
-func openImage(file io.Reader, imageType string) (image.Image, error) {
-	var img image.Image
-	var err error
-
-	switch imageType {
-	case "image/jpg":
-		fallthrough
-	case "image/jpeg":
-		img, err = jpeg.Decode(file)
-		if err != nil {
-			return nil, err
-		}
-	case "image/png":
-		img, err = png.Decode(file)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, fmt.Errorf("Not supported image format: %s", imageType)
-	}
+// ProcessImage ...
+func (h ProcessHandler) ProcessImage(file io.Reader, imageType string, config models.CalculatorConfig, opts processimage.Options) (server.CommonColorsResp, error) {
+	logging.Or(opts.Logger).Debug("Processing image", "type", imageType, "config", config)
 
-	return img, nil
+	return processimage.FromReader(file, imageType, config, opts)
 }
 
-func colorsFromImage(i image.Image) (result []color.Color) {
-	b := i.Bounds()
-	s := b.Size()
-
-	for x := 0; x < s.X; x++ {
-		for y := 0; y < s.Y; y++ {
-			c := color.NewFromRGBA(i.At(x, y))
+// ProcessURL downloads the image with the SSRF protected fetcher and processes it like an upload
+func (h ProcessHandler) ProcessURL(ctx context.Context, url string, config models.CalculatorConfig, opts processimage.Options) (server.CommonColorsResp, error) {
+	logging.Or(opts.Logger).Debug("Processing URL", "url", url, "config", config)
 
-			result = append(result, c)
-		}
+	fetcher := h.Fetcher
+	if fetcher == nil {
+		fetcher = processimage.DefaultFetcher
 	}
 
-	return result
+	return fetcher.FromURLWithConfig(ctx, url, config, opts)
 }
 
 // func getColorCoords(image image.Image) (result []ColorCoord) {
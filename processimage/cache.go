@@ -0,0 +1,137 @@
+package processimage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simonmarton/common-colors/models"
+)
+
+// cachedImage is a downloaded image with its HTTP validators
+type cachedImage struct {
+	Body         []byte    `json:"body"`
+	ImageType    string    `json:"imageType"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"lastModified"`
+	Expires      time.Time `json:"expires"`
+}
+
+func (f *Fetcher) cachedImage(url string) *cachedImage {
+	if f.config.Cache == nil {
+		return nil
+	}
+
+	data, ok := f.config.Cache.Get("image:" + url)
+	if !ok {
+		return nil
+	}
+
+	var img cachedImage
+	if err := json.Unmarshal(data, &img); err != nil {
+		return nil
+	}
+
+	return &img
+}
+
+func (f *Fetcher) storeImage(url string, img *cachedImage) {
+	if f.config.Cache == nil {
+		return
+	}
+
+	data, err := json.Marshal(img)
+	if err != nil {
+		return
+	}
+
+	f.config.Cache.Set("image:"+url, data)
+}
+
+// resultKey identifies a result by the image bytes and everything it was calculated with,
+// false is returned if the options can't be cached
+func resultKey(body []byte, config models.CalculatorConfig, opts Options) (string, bool) {
+	// A mask image has no stable representation to hash, and a cached result wouldn't report its steps
+	if opts.Selection.Mask != nil || opts.OnStep != nil {
+		return "", false
+	}
+
+	params, err := json.Marshal(struct {
+		Config models.CalculatorConfig
+		Opts   Options
+	}{config, opts})
+	if err != nil {
+		return "", false
+	}
+
+	bodySum := sha256.Sum256(body)
+	paramsSum := sha256.Sum256(params)
+
+	return "result:" + hex.EncodeToString(bodySum[:]) + ":" + hex.EncodeToString(paramsSum[:]), true
+}
+
+func (f *Fetcher) cachedResult(key string) (result models.CommonColorsResp, ok bool) {
+	if f.config.Cache == nil {
+		return result, false
+	}
+
+	data, ok := f.config.Cache.Get(key)
+	if !ok {
+		return result, false
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, false
+	}
+
+	return result, true
+}
+
+func (f *Fetcher) storeResult(key string, result models.CommonColorsResp) {
+	if f.config.Cache == nil {
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+
+	f.config.Cache.Set(key, data)
+}
+
+// freshness tells until when a response can be used without revalidation based on its
+// Cache-Control or Expires headers, store is false for no-store responses
+func freshness(h http.Header, now time.Time) (expires time.Time, store bool) {
+	expires = now
+	hasMaxAge := false
+
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+
+		switch {
+		case directive == "no-store":
+			return now, false
+		case directive == "no-cache":
+			return now, true
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil && seconds > 0 {
+				expires = now.Add(time.Duration(seconds) * time.Second)
+				hasMaxAge = true
+			}
+		}
+	}
+
+	if !hasMaxAge {
+		if t, err := http.ParseTime(h.Get("Expires")); err == nil && t.After(now) {
+			expires = t
+		}
+	}
+
+	return expires, true
+}
@@ -0,0 +1,241 @@
+package processimage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/simonmarton/common-colors/cache"
+)
+
+const defaultConnectTimeout = 5 * time.Second
+const defaultReadTimeout = 30 * time.Second
+const defaultMaxBodySize int64 = 10 << 20
+const defaultMaxRedirects int = 5
+
+// ErrBodyTooLarge is returned when the response is bigger than the allowed MaxBodySize
+var ErrBodyTooLarge = errors.New("Response body too large")
+
+// StatusError is returned for non 2xx responses
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Unexpected status code %d for %s", e.StatusCode, e.URL)
+}
+
+// FetchError is returned when the image can't be downloaded, e.g. the host can't be resolved,
+// refuses the connection or doesn't answer within the timeout
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("Failed to fetch %s: %v", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedTypeError is returned when the response is not a supported image
+type UnsupportedTypeError struct {
+	ContentType string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("Not supported image format: %s", e.ContentType)
+}
+
+// FetcherConfig defines the limits of downloading an image
+type FetcherConfig struct {
+	// ConnectTimeout limits dialing and the TLS handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout limits the whole request, from connecting until the body is read
+	ReadTimeout  time.Duration
+	MaxBodySize  int64
+	MaxRedirects int
+
+	// AllowPrivateNetworks turns off blocking private, loopback, link-local and metadata addresses,
+	// only for trusted URLs
+	AllowPrivateNetworks bool
+	// AllowedHosts restricts requests to these hosts if not empty, "*.example.com" matches subdomains
+	AllowedHosts []string
+	// DeniedHosts are never requested, even if they are allowed
+	DeniedHosts []string
+	// Resolver is used to look up hosts, net.DefaultResolver if not set
+	Resolver Resolver
+
+	// Cache stores downloaded images and the results calculated from them when set,
+	// images are revalidated with ETag and Last-Modified once their Cache-Control max-age passes
+	Cache cache.Cache
+}
+
+// Fetcher downloads images over http
+type Fetcher struct {
+	config FetcherConfig
+	client *http.Client
+	now    func() time.Time
+}
+
+// DefaultFetcher is used by FromURL
+var DefaultFetcher = NewFetcher(FetcherConfig{})
+
+// NewFetcher creates a Fetcher, zero values are replaced with defaults
+func NewFetcher(c FetcherConfig) *Fetcher {
+	if c.ConnectTimeout <= 0 {
+		c.ConnectTimeout = defaultConnectTimeout
+	}
+
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = defaultReadTimeout
+	}
+
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = defaultMaxBodySize
+	}
+
+	if c.MaxRedirects <= 0 {
+		c.MaxRedirects = defaultMaxRedirects
+	}
+
+	if c.Resolver == nil {
+		c.Resolver = net.DefaultResolver
+	}
+
+	f := &Fetcher{config: c, now: time.Now}
+
+	// No proxy, it would make the connection to the checked address pointless
+	dialer := &net.Dialer{Timeout: c.ConnectTimeout}
+	transport := &http.Transport{
+		DialContext:         f.dialContext(dialer),
+		TLSHandshakeTimeout: c.ConnectTimeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	f.client = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if len(via) > c.MaxRedirects {
+				return fmt.Errorf("Stopped after %d redirects", c.MaxRedirects)
+			}
+			return checkScheme(r)
+		},
+	}
+
+	return f
+}
+
+// Client is the http.Client of the fetcher with the same host restrictions,
+// for other requests to user provided URLs like webhooks
+func (f *Fetcher) Client() *http.Client {
+	return f.client
+}
+
+// checkScheme only lets http and https requests through
+func checkScheme(r *http.Request) error {
+	if r.URL.Scheme != "http" && r.URL.Scheme != "https" {
+		return &BlockedError{Host: r.URL.Host, Reason: fmt.Sprintf("scheme %s is not allowed", r.URL.Scheme)}
+	}
+
+	return nil
+}
+
+// Fetch downloads an image and returns its bytes with the content type detected from them
+func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.config.ReadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/png, image/jpeg")
+
+	if err := checkScheme(req); err != nil {
+		return nil, "", err
+	}
+
+	cached := f.cachedImage(url)
+	if cached != nil {
+		if f.now().Before(cached.Expires) {
+			return cached.Body, cached.ImageType, nil
+		}
+
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", &FetchError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		if expires, store := freshness(resp.Header, f.now()); store {
+			cached.Expires = expires
+			f.storeImage(url, cached)
+		}
+
+		return cached.Body, cached.ImageType, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", &StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	// Content-Type is broken on Bitrise, so only obviously wrong ones are rejected
+	// and the actual format is detected from the bytes
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") &&
+		!strings.HasPrefix(contentType, "application/octet-stream") &&
+		!strings.HasPrefix(contentType, "binary/octet-stream") {
+		return nil, "", &UnsupportedTypeError{ContentType: contentType}
+	}
+
+	if resp.ContentLength > f.config.MaxBodySize {
+		return nil, "", ErrBodyTooLarge
+	}
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(resp.Body, f.config.MaxBodySize+1))
+	if err != nil {
+		return nil, "", &FetchError{URL: url, Err: err}
+	}
+
+	if n > f.config.MaxBodySize {
+		return nil, "", ErrBodyTooLarge
+	}
+
+	detected := http.DetectContentType(buf.Bytes())
+	if detected != "image/png" && detected != "image/jpeg" {
+		return nil, "", &UnsupportedTypeError{ContentType: detected}
+	}
+
+	if expires, store := freshness(resp.Header, f.now()); store {
+		f.storeImage(url, &cachedImage{
+			Body:         buf.Bytes(),
+			ImageType:    detected,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Expires:      expires,
+		})
+	}
+
+	return buf.Bytes(), detected, nil
+}
@@ -0,0 +1,383 @@
+package processimage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/simonmarton/common-colors/cache"
+)
+
+func pngBytes(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// testFetcher allows loopback addresses for httptest servers
+func testFetcher(c FetcherConfig) *Fetcher {
+	c.AllowPrivateNetworks = true
+	return NewFetcher(c)
+}
+
+func TestFetch(t *testing.T) {
+	body := pngBytes(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Wrong content type, the format is detected from the bytes
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	got, imageType, err := testFetcher(FetcherConfig{}).Fetch(context.Background(), ts.URL+"/icon.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if imageType != "image/png" {
+		t.Errorf("Expected image/png, got %s", imageType)
+	}
+
+	if !bytes.Equal(got, body) {
+		t.Errorf("Expected the response body")
+	}
+}
+
+func TestFetchStatusError(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	_, _, err := testFetcher(FetcherConfig{}).Fetch(context.Background(), ts.URL)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 StatusError, got %v", err)
+	}
+}
+
+func TestFetchTooLarge(t *testing.T) {
+	body := pngBytes(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Chunked, no Content-Length
+		w.Write(body[:10])
+		w.(http.Flusher).Flush()
+		w.Write(body[10:])
+	}))
+	defer ts.Close()
+
+	_, _, err := testFetcher(FetcherConfig{MaxBodySize: 20}).Fetch(context.Background(), ts.URL)
+	if err != ErrBodyTooLarge {
+		t.Errorf("Expected ErrBodyTooLarge, got %v", err)
+	}
+}
+
+func TestFetchUnsupportedType(t *testing.T) {
+	var fetchTests = []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/html", pngBytes(t)},
+		{"image/png", []byte("<html></html>")},
+	}
+
+	for _, tt := range fetchTests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			w.Write(tt.body)
+		}))
+
+		_, _, err := testFetcher(FetcherConfig{}).Fetch(context.Background(), ts.URL)
+
+		var typeErr *UnsupportedTypeError
+		if !errors.As(err, &typeErr) {
+			t.Errorf("Expected UnsupportedTypeError for %s, got %v", tt.contentType, err)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestFetchMaxRedirects(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, ts.URL+"/loop", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	_, _, err := testFetcher(FetcherConfig{MaxRedirects: 2}).Fetch(context.Background(), ts.URL)
+	if err == nil {
+		t.Errorf("Expected redirect error")
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	start := time.Now()
+	_, _, err := testFetcher(FetcherConfig{ReadTimeout: 50 * time.Millisecond}).Fetch(context.Background(), ts.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected fetch to time out quickly")
+	}
+}
+
+func TestFetchCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := testFetcher(FetcherConfig{}).Fetch(ctx, ts.URL)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled error, got %v", err)
+	}
+}
+
+// fakeResolver maps hosts to fixed addresses
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(ctx context.Context, host string) (result []net.IPAddr, err error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	for _, ip := range ips {
+		result = append(result, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+
+	return result, nil
+}
+
+func TestFetchBlocksLoopback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Request should have been blocked")
+	}))
+	defer ts.Close()
+
+	_, _, err := NewFetcher(FetcherConfig{}).Fetch(context.Background(), ts.URL)
+
+	var blockedErr *BlockedError
+	if !errors.As(err, &blockedErr) {
+		t.Errorf("Expected BlockedError, got %v", err)
+	}
+}
+
+func TestFetchResolver(t *testing.T) {
+	body := pngBytes(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	resolver := fakeResolver{
+		"images.example.com": {"127.0.0.1"},
+		"rebind.example.com": {"93.184.216.34", "127.0.0.1"},
+		"meta.example.com":   {"169.254.169.254"},
+	}
+
+	var fetchTests = []struct {
+		host    string
+		config  FetcherConfig
+		blocked bool
+	}{
+		{"images.example.com", FetcherConfig{}, true},
+		{"rebind.example.com", FetcherConfig{}, true},
+		{"meta.example.com", FetcherConfig{}, true},
+		{"images.example.com", FetcherConfig{AllowPrivateNetworks: true}, false},
+		{"images.example.com", FetcherConfig{AllowPrivateNetworks: true, AllowedHosts: []string{"*.example.com"}}, false},
+		{"images.example.com", FetcherConfig{AllowPrivateNetworks: true, AllowedHosts: []string{"example.com"}}, true},
+		{"images.example.com", FetcherConfig{AllowPrivateNetworks: true, DeniedHosts: []string{"images.example.com"}}, true},
+	}
+
+	for _, tt := range fetchTests {
+		tt.config.Resolver = resolver
+		_, _, err := NewFetcher(tt.config).Fetch(context.Background(), "http://"+net.JoinHostPort(tt.host, port))
+
+		var blockedErr *BlockedError
+		if blocked := errors.As(err, &blockedErr); blocked != tt.blocked {
+			t.Errorf("Expected blocked %v for %s with %+v, got %v", tt.blocked, tt.host, tt.config, err)
+		}
+
+		if !tt.blocked && err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	}
+}
+
+func TestFetchBlocksRedirect(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://internal.example.com/", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	f := testFetcher(FetcherConfig{DeniedHosts: []string{"internal.example.com"}})
+	_, _, err := f.Fetch(context.Background(), ts.URL)
+
+	var blockedErr *BlockedError
+	if !errors.As(err, &blockedErr) {
+		t.Errorf("Expected BlockedError, got %v", err)
+	}
+}
+
+func TestFetchBlocksScheme(t *testing.T) {
+	for _, u := range []string{"file:///etc/passwd", "ftp://example.com/icon.png", "gopher://example.com"} {
+		_, _, err := NewFetcher(FetcherConfig{}).Fetch(context.Background(), u)
+
+		var blockedErr *BlockedError
+		if !errors.As(err, &blockedErr) {
+			t.Errorf("Expected BlockedError for %s, got %v", u, err)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	var ipTests = []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+
+	for _, tt := range ipTests {
+		if isPublicIP(net.ParseIP(tt.ip)) != tt.public {
+			t.Errorf("Expected public %v for %s", tt.public, tt.ip)
+		}
+	}
+}
+
+func TestFetchCache(t *testing.T) {
+	body := pngBytes(t)
+	requests, notModified := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	f := testFetcher(FetcherConfig{Cache: cache.NewMemory(0, 0)})
+	f.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := f.Fetch(context.Background(), ts.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected a fresh image to be served from cache, got %d requests", requests)
+	}
+
+	now = now.Add(2 * time.Minute)
+	got, _, err := f.Fetch(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 2 || notModified != 1 || !bytes.Equal(got, body) {
+		t.Errorf("Expected a stale image to be revalidated, got %d requests, %d not modified", requests, notModified)
+	}
+
+	// Revalidation extends the freshness
+	f.Fetch(context.Background(), ts.URL)
+	if requests != 2 {
+		t.Errorf("Expected revalidated image to be fresh, got %d requests", requests)
+	}
+}
+
+func TestFetchCacheNoStore(t *testing.T) {
+	body := pngBytes(t)
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	c := cache.NewMemory(0, 0)
+	f := testFetcher(FetcherConfig{Cache: c})
+	f.Fetch(context.Background(), ts.URL)
+	f.Fetch(context.Background(), ts.URL)
+
+	if requests != 2 || c.Len() != 0 {
+		t.Errorf("Expected no-store images not to be cached, got %d requests", requests)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var freshnessTests = []struct {
+		cacheControl string
+		expires      string
+		expected     time.Time
+		store        bool
+	}{
+		{"", "", now, true},
+		{"public, max-age=3600", "", now.Add(time.Hour), true},
+		{"max-age=3600, no-cache", "", now, true},
+		{"no-store", "", now, false},
+		{"", "Wed, 01 Jan 2020 02:00:00 GMT", now.Add(2 * time.Hour), true},
+		{"max-age=60", "Wed, 01 Jan 2020 02:00:00 GMT", now.Add(time.Minute), true},
+	}
+
+	for _, tt := range freshnessTests {
+		h := http.Header{}
+		h.Set("Cache-Control", tt.cacheControl)
+		h.Set("Expires", tt.expires)
+
+		expires, store := freshness(h, now)
+		if !expires.Equal(tt.expected) || store != tt.store {
+			t.Errorf("freshness error for %q %q, expected %v %v, got %v %v", tt.cacheControl, tt.expires, tt.expected, tt.store, expires, store)
+		}
+	}
+}
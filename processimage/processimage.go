@@ -2,133 +2,89 @@ package processimage
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
-	"io/ioutil"
-	"net/http"
-	"path"
 
-	"github.com/nfnt/resize"
-	"github.com/simonmarton/common-colors/calculator"
-	"github.com/simonmarton/common-colors/color"
 	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
 )
 
-// FromURL ...
-func FromURL(url string) ([]string, error) {
-	calculator := calculator.New(models.CalculatorConfig{
-		Algorithm:            "yiq",
-		TransparencyTreshold: 10,
-		IterationCount:       3,
-		MinLuminance:         0.3,
-		MaxLuminance:         0.9,
-		DistanceThreshold:    20,
-		MinSaturation:        0.3,
-	})
-
-	client := httpClient()
-
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, err
-	}
+// defaultURLConfig is used by FromURL
+var defaultURLConfig = models.CalculatorConfig{
+	Algorithm:            "yiq",
+	TransparencyTreshold: 10,
+	IterationCount:       3,
+	MinLuminance:         0.3,
+	MaxLuminance:         0.9,
+	DistanceThreshold:    20,
+	MinSaturation:        0.3,
+}
 
-	// Content-Type is broken currently on Bitrise
-	// openImage(resp.Body, resp.Header.Get("Content-Type"))
+// Options of processing an image besides the calculator config
+type Options = pipeline.Options
 
-	img, err := openImage(resp.Body, path.Ext(url))
+// FromURL downloads an image with the DefaultFetcher and calculates its gradient colors
+func FromURL(ctx context.Context, url string) ([]string, error) {
+	result, err := FromURLWithConfig(ctx, url, defaultURLConfig, Options{})
 	if err != nil {
 		return nil, err
 	}
 
-	img = resizeImage(img, 32, 32)
-	colors := colorsFromImage(img)
-
-	commonColors, _ := calculator.GetCommonColors(colors)
-
-	if len(commonColors) == 0 {
-		return nil, fmt.Errorf("All colors were filtered")
-	}
-
-	return calculator.GenrateGradientColors(commonColors), nil
+	return result.Gradient, nil
 }
 
-func httpClient() *http.Client {
-	client := http.Client{
-		CheckRedirect: func(r *http.Request, via []*http.Request) error {
-			r.URL.Opaque = r.URL.Path
-			return nil
-		},
-	}
-
-	return &client
+// FromURLWithConfig downloads an image with the DefaultFetcher and calculates its common colors
+func FromURLWithConfig(ctx context.Context, url string, config models.CalculatorConfig, opts Options) (models.CommonColorsResp, error) {
+	return DefaultFetcher.FromURLWithConfig(ctx, url, config, opts)
 }
 
-func openImage(file io.Reader, imageType string) (image.Image, error) {
-	var img image.Image
-	var err error
+// FromURLWithConfig downloads an image and calculates its common colors,
+// the result is cached with the image when the fetcher has a Cache
+func (f *Fetcher) FromURLWithConfig(ctx context.Context, url string, config models.CalculatorConfig, opts Options) (models.CommonColorsResp, error) {
+	if err := pipeline.Validate(config); err != nil {
+		return models.CommonColorsResp{}, err
+	}
 
-	// save original bytes for the future
-	originalBytes, err := ioutil.ReadAll(file)
+	body, imageType, err := f.Fetch(ctx, url)
 	if err != nil {
-		return nil, err
+		return models.CommonColorsResp{}, err
 	}
-	file = ioutil.NopCloser(bytes.NewReader(originalBytes)) // reset file stream
-
-	switch imageType {
-	case ".jpg":
-		fallthrough
-	case ".jpeg":
-		fallthrough
-	case "image/jpg":
-		fallthrough
-	case "image/jpeg":
-		img, err = jpeg.Decode(file)
-		if err != nil {
-			file = ioutil.NopCloser(bytes.NewReader(originalBytes)) // reset file stream
-			img, err = png.Decode(file)
-			if err != nil {
-				return nil, err
-			}
-		}
-	case ".png":
-		fallthrough
-	case "image/png":
-		img, err = png.Decode(file)
-		if err != nil {
-			return nil, err
+
+	key, cacheable := resultKey(body, config, opts)
+	if cacheable {
+		if result, ok := f.cachedResult(key); ok {
+			return result, nil
 		}
-	default:
-		return nil, fmt.Errorf("Not supported image format: %s", imageType)
 	}
 
-	return img, nil
-}
+	result, err := FromReader(bytes.NewReader(body), imageType, config, opts)
+	if err != nil {
+		return models.CommonColorsResp{}, err
+	}
 
-func colorsFromImage(i image.Image) (result []color.Color) {
-	b := i.Bounds()
-	s := b.Size()
+	if cacheable {
+		f.storeResult(key, result)
+	}
 
-	for x := 0; x < s.X; x++ {
-		for y := 0; y < s.Y; y++ {
-			c := color.NewFromRGBA(i.At(x, y))
+	return result, nil
+}
 
-			result = append(result, c)
-		}
+// FromReader decodes an image and calculates its common colors within opts.Limits,
+// imageType is either a MIME type or a file extension
+func FromReader(file io.Reader, imageType string, config models.CalculatorConfig, opts Options) (models.CommonColorsResp, error) {
+	if err := pipeline.Validate(config); err != nil {
+		return models.CommonColorsResp{}, err
 	}
 
-	return result
+	return pipeline.New(opts.Limits.Apply(config)).RunReader(file, imageType, opts)
 }
 
-func resizeImage(img image.Image, width, height int) image.Image {
-	bounds := img.Bounds()
-
-	if bounds.Dx() > width || bounds.Dy() > height {
-		return resize.Resize(uint(width), uint(height), img, resize.Lanczos3)
+// Process calculates the common colors of a decoded image within opts.Limits
+func Process(img image.Image, config models.CalculatorConfig, opts Options) (models.CommonColorsResp, error) {
+	if err := pipeline.Validate(config); err != nil {
+		return models.CommonColorsResp{}, err
 	}
 
-	return img
+	return pipeline.New(opts.Limits.Apply(config)).Run(img, opts)
 }
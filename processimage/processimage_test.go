@@ -0,0 +1,106 @@
+package processimage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/simonmarton/common-colors/cache"
+	"github.com/simonmarton/common-colors/models"
+)
+
+func TestFromReader(t *testing.T) {
+	f, err := os.Open("../test-images/test-colors.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	result, err := FromReader(f, ".png", models.CalculatorConfig{}, Options{WithSteps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Colors) == 0 || len(result.Gradient) != 2 {
+		t.Errorf("Expected colors and a gradient, got %+v", result)
+	}
+
+	if result.StepsOfColors == nil {
+		t.Errorf("Expected steps")
+	}
+}
+
+func TestFromReaderUnsupported(t *testing.T) {
+	f, err := os.Open("../test-images/test-colors.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := FromReader(f, "image/gif", models.CalculatorConfig{}, Options{}); err == nil {
+		t.Errorf("Expected unsupported format error")
+	}
+}
+
+func TestFromURLWithConfig(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("../test-images")))
+	defer ts.Close()
+
+	defaultFetcher := DefaultFetcher
+	DefaultFetcher = testFetcher(FetcherConfig{})
+	defer func() { DefaultFetcher = defaultFetcher }()
+
+	result, err := FromURLWithConfig(context.Background(), ts.URL+"/test-colors.png", models.CalculatorConfig{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Colors) == 0 || result.StepsOfColors != nil {
+		t.Errorf("Expected colors without steps, got %+v", result)
+	}
+
+	gradient, err := FromURL(context.Background(), ts.URL+"/test-colors.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gradient) != 2 {
+		t.Errorf("Expected 2 gradient colors, got %v", gradient)
+	}
+}
+
+func TestFromURLWithConfigCachedResult(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("../test-images")))
+	defer ts.Close()
+
+	c := cache.NewMemory(0, 0)
+	defaultFetcher := DefaultFetcher
+	DefaultFetcher = testFetcher(FetcherConfig{Cache: c})
+	defer func() { DefaultFetcher = defaultFetcher }()
+
+	first, err := FromURLWithConfig(context.Background(), ts.URL+"/test-colors.png", models.CalculatorConfig{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Image and result
+	if c.Len() != 2 {
+		t.Fatalf("Expected 2 cached values, got %d", c.Len())
+	}
+
+	second, err := FromURLWithConfig(context.Background(), ts.URL+"/test-colors.png", models.CalculatorConfig{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Gradient[0] != second.Gradient[0] {
+		t.Errorf("Expected the same result from cache")
+	}
+
+	FromURLWithConfig(context.Background(), ts.URL+"/test-colors.png", models.CalculatorConfig{Algorithm: "yiq"}, Options{})
+	if c.Len() != 3 {
+		t.Errorf("Expected a different config to be cached separately, got %d values", c.Len())
+	}
+}
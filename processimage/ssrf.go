@@ -0,0 +1,151 @@
+package processimage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Resolver looks up the addresses of a host, *net.Resolver implements it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// BlockedError is returned when a URL points to a host or address which is not allowed
+type BlockedError struct {
+	Host   string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("Blocked request to %s: %s", e.Host, e.Reason)
+}
+
+// Ranges not covered by the net.IP helpers which should never be reachable from a URL
+var blockedNetworks = parseCIDRs(
+	"0.0.0.0/8",       // "this" network
+	"100.64.0.0/10",   // carrier-grade NAT
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"240.0.0.0/4",     // reserved
+	"64:ff9b::/96",    // NAT64, can map to private IPv4 addresses
+	"2001:db8::/32",   // documentation
+)
+
+func parseCIDRs(cidrs ...string) (result []*net.IPNet) {
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, n)
+	}
+
+	return result
+}
+
+// isPublicIP is false for private, loopback, link-local (including the 169.254.169.254 metadata service),
+// multicast and reserved addresses
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchHost checks a host against a list of patterns, "example.com" matches only itself,
+// "*.example.com" matches its subdomains
+func matchHost(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if strings.HasPrefix(p, "*.") {
+			if strings.HasSuffix(host, p[1:]) {
+				return true
+			}
+		} else if host == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkHost applies the allow and deny lists of the config
+func (f *Fetcher) checkHost(host string) error {
+	if matchHost(host, f.config.DeniedHosts) {
+		return &BlockedError{Host: host, Reason: "host is denied"}
+	}
+
+	if len(f.config.AllowedHosts) > 0 && !matchHost(host, f.config.AllowedHosts) {
+		return &BlockedError{Host: host, Reason: "host is not allowed"}
+	}
+
+	return nil
+}
+
+// dialContext resolves the host itself and connects to the checked address,
+// so a second DNS lookup can't point the connection somewhere else
+func (f *Fetcher) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := f.checkHost(host); err != nil {
+			return nil, err
+		}
+
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IP{ip}
+		} else {
+			addrs, err := f.config.Resolver.LookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, a := range addrs {
+				ips = append(ips, a.IP)
+			}
+		}
+
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("No addresses found for %s", host)
+		}
+
+		// Every address has to be public, otherwise a rebinding attack could still pick a private one
+		if !f.config.AllowPrivateNetworks {
+			for _, ip := range ips {
+				if !isPublicIP(ip) {
+					return nil, &BlockedError{Host: host, Reason: fmt.Sprintf("address %s is not public", ip)}
+				}
+			}
+		}
+
+		var conn net.Conn
+		for _, ip := range ips {
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
@@ -0,0 +1,9 @@
+// Package public contains the web pages of the server
+package public
+
+import "embed"
+
+// FS holds the config tester, the 3D chart and their scripts
+//
+//go:embed *.html favicon.ico js
+var FS embed.FS
@@ -213,22 +213,27 @@ let stepIdx = 0;
 
 const next = document.getElementById('next');
 
-// eslint-disable-next-line no-undef
-appendUploadButton(
-  ({ steps }) => {
-    allSteps = steps;
-    stepIdx = 0;
-
-    next.removeAttribute('disabled');
-
-    process();
-  },
-  () => ({
-    algorithm: 'yiq',
-    distanceThreshold: 30
-  }),
-  true
-);
+document.querySelector('input[type=file]').addEventListener('change', evt => {
+  const {
+    files: [image]
+  } = evt.target;
+
+  allSteps = [];
+  stepIdx = 0;
+
+  // Steps are shown live while the server is still clustering
+  // eslint-disable-next-line no-undef
+  streamImage(image, { algorithm: 'yiq', distanceThreshold: 30 }, step => {
+    allSteps.push(step);
+
+    if (stepIdx === allSteps.length - 1) {
+      process();
+    } else {
+      next.removeAttribute('disabled');
+      next.innerText = `next ${stepIdx + 1} / ${allSteps.length}`;
+    }
+  });
+});
 
 const process = () => {
   if (stepIdx == allSteps.length) {
@@ -259,6 +264,8 @@ const process = () => {
 
   if (stepIdx === allSteps.length) {
     next.setAttribute('disabled', true);
+  } else {
+    next.removeAttribute('disabled');
   }
 
   console.timeEnd('process');
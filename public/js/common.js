@@ -20,8 +20,7 @@ const appendUploadButton = (afterUpload = () => {}, getConfig = () => {}, withSt
   });
 };
 
-// eslint-disable-next-line no-unused-vars
-const uploadImage = async (image, config = {}, withSteps) => {
+const createForm = (image, config = {}) => {
   if (!image) {
     throw new Error('Select an image');
   }
@@ -57,12 +56,62 @@ const uploadImage = async (image, config = {}, withSteps) => {
 
   reader.readAsDataURL(image);
 
-  const result = await fetch(`/api/upload${withSteps ? '?steps' : ''}`, {
+  return formData;
+};
+
+// eslint-disable-next-line no-unused-vars
+const uploadImage = async (image, config = {}, withSteps) => {
+  const result = await fetch(`/api/v1/upload${withSteps ? '?steps' : ''}`, {
     method: 'post',
-    body: formData
+    body: createForm(image, config)
   }).then(res => res.json());
 
+  if (result && result.error) {
+    throw new Error(result.error.message);
+  }
+
   const { colors, gradient, steps } = result || {};
 
   return { colors, gradient, steps };
 };
+
+// Calls onStep with every clustering step as the server finishes it
+// eslint-disable-next-line no-unused-vars
+const streamImage = async (image, config = {}, onStep = () => {}) => {
+  const res = await fetch('/api/v1/upload?stream=ndjson', {
+    method: 'post',
+    body: createForm(image, config)
+  });
+
+  const reader = res.body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = '';
+  let result = {};
+
+  for (;;) {
+    const { done, value } = await reader.read();
+    if (done) {
+      break;
+    }
+
+    buffer += decoder.decode(value, { stream: true });
+    const lines = buffer.split('\n');
+    buffer = lines.pop();
+
+    lines.filter(Boolean).forEach(line => {
+      const { event, data } = JSON.parse(line);
+
+      if (event === 'step') {
+        onStep(data);
+      } else if (event === 'result') {
+        result = data;
+      } else if (event === 'error') {
+        throw new Error(data.message);
+      }
+    });
+  }
+
+  const { colors, gradient } = result;
+
+  return { colors, gradient };
+};
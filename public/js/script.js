@@ -46,7 +46,7 @@ const handleResult = ({ colors, gradient }) => {
 
     const weightElem = document.createElement('span');
     weightElem.className = 'weight';
-    weightElem.innerText = `${percetage.toFixed(2)}% (h: ${hueDistance.toFixed(2)}, w: ${weight})`;
+    weightElem.innerText = `${percetage.toFixed(2)}% (h: ${hueDistance.toFixed(2)}, w: ${Number(weight.toFixed(2))})`;
 
     container.appendChild(color);
     container.appendChild(weightElem);
@@ -0,0 +1,51 @@
+package sampler
+
+import (
+	"image"
+	"image/color"
+)
+
+// boxResize downscales by averaging every source pixel covered by a destination pixel,
+// the averaging is done on premultiplied values so transparent pixels don't darken the result
+func boxResize(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for dx := 0; dx < width; dx++ {
+		for dy := 0; dy < height; dy++ {
+			src := sourceRect(bounds, width, height, dx, dy)
+
+			var sumR, sumG, sumB, sumA, n uint64
+			for x := src.Min.X; x < src.Max.X; x++ {
+				for y := src.Min.Y; y < src.Max.Y; y++ {
+					r, g, b, a := img.At(x, y).RGBA()
+					sumR += uint64(r)
+					sumG += uint64(g)
+					sumB += uint64(b)
+					sumA += uint64(a)
+					n++
+				}
+			}
+
+			dst.SetRGBA64(dx, dy, color.RGBA64{
+				R: uint16(sumR / n),
+				G: uint16(sumG / n),
+				B: uint16(sumB / n),
+				A: uint16(sumA / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// sourceRect is the area of the original image which is scaled into the dx, dy pixel
+// of a width x height sized image
+func sourceRect(bounds image.Rectangle, width, height, dx, dy int) image.Rectangle {
+	x0 := bounds.Min.X + dx*bounds.Dx()/width
+	x1 := max(x0+1, bounds.Min.X+(dx+1)*bounds.Dx()/width)
+	y0 := bounds.Min.Y + dy*bounds.Dy()/height
+	y1 := max(y0+1, bounds.Min.Y+(dy+1)*bounds.Dy()/height)
+
+	return image.Rect(x0, y0, x1, y1)
+}
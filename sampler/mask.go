@@ -0,0 +1,193 @@
+package sampler
+
+import (
+	"image"
+	imagecolor "image/color"
+	"math"
+	"sort"
+
+	"github.com/simonmarton/common-colors/models"
+)
+
+// Mask selects the pixels of an image to be sampled
+type Mask interface {
+	// Bounds of the selected area, pixels outside of it are never selected
+	Bounds() image.Rectangle
+	// Coverage of a pixel between 0-1, 0 means it's not selected
+	Coverage(x, y int) float64
+}
+
+type selectionMask struct {
+	selection models.Selection
+	image     image.Rectangle
+	bounds    image.Rectangle
+	// inside are the pixels of bounds inside any of the polygons, row by row
+	inside []bool
+}
+
+// NewMask creates a Mask for an image with the given bounds,
+// nil is returned for an empty selection so every pixel is sampled
+func NewMask(s models.Selection, bounds image.Rectangle) Mask {
+	if s.Rect == nil && len(s.Polygons) == 0 && s.Mask == nil {
+		return nil
+	}
+
+	m := selectionMask{selection: s, image: bounds, bounds: bounds}
+
+	if s.Rect != nil {
+		r := image.Rect(s.Rect.X, s.Rect.Y, s.Rect.X+s.Rect.Width, s.Rect.Y+s.Rect.Height)
+		m.bounds = m.bounds.Intersect(r.Add(bounds.Min))
+	}
+
+	if len(s.Polygons) > 0 {
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		for _, polygon := range s.Polygons {
+			for _, p := range polygon {
+				minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+				maxX, maxY = math.Max(maxX, p.X), math.Max(maxY, p.Y)
+			}
+		}
+
+		r := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+		m.bounds = m.bounds.Intersect(r.Add(bounds.Min))
+		m.inside = rasterize(s.Polygons, bounds.Min, m.bounds)
+	}
+
+	return m
+}
+
+// rasterize fills the pixels of r whose center is inside any of the polygons by the even-odd rule,
+// once per image instead of testing every pixel against every edge. The polygons are relative to origin.
+func rasterize(polygons [][]models.Point, origin image.Point, r image.Rectangle) []bool {
+	inside := make([]bool, r.Dx()*r.Dy())
+
+	var crossings []float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		py := float64(y-origin.Y) + .5
+		row := inside[(y-r.Min.Y)*r.Dx():]
+
+		for _, polygon := range polygons {
+			crossings = crossings[:0]
+			for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+				a, b := polygon[i], polygon[j]
+				if (a.Y > py) != (b.Y > py) {
+					crossings = append(crossings, (b.X-a.X)*(py-a.Y)/(b.Y-a.Y)+a.X)
+				}
+			}
+			sort.Float64s(crossings)
+
+			// A pixel center px is inside between every pair of crossings, c0 <= px < c1
+			for k := 0; k+1 < len(crossings); k += 2 {
+				from := clamp(math.Ceil(crossings[k]-.5)+float64(origin.X), r.Min.X, r.Max.X)
+				to := clamp(math.Ceil(crossings[k+1]-.5)+float64(origin.X), r.Min.X, r.Max.X)
+				for x := from; x < to; x++ {
+					row[x-r.Min.X] = true
+				}
+			}
+		}
+	}
+
+	return inside
+}
+
+func (m selectionMask) Bounds() image.Rectangle {
+	return m.bounds
+}
+
+func (m selectionMask) Coverage(x, y int) float64 {
+	if !image.Pt(x, y).In(m.bounds) {
+		return 0
+	}
+
+	if m.inside != nil && !m.inside[(y-m.bounds.Min.Y)*m.bounds.Dx()+x-m.bounds.Min.X] {
+		return 0
+	}
+
+	if m.selection.Mask != nil {
+		// Stretch the mask over the image if their sizes differ
+		mb := m.selection.Mask.Bounds()
+		mx := mb.Min.X + (x-m.image.Min.X)*mb.Dx()/m.image.Dx()
+		my := mb.Min.Y + (y-m.image.Min.Y)*mb.Dy()/m.image.Dy()
+
+		// Gray is calculated from premultiplied values, so transparency counts as black
+		g := imagecolor.Gray16Model.Convert(m.selection.Mask.At(mx, my)).(imagecolor.Gray16)
+		return float64(g.Y) / 0xffff
+	}
+
+	return 1
+}
+
+// clamp converts v to an int within min and max
+func clamp(v float64, min, max int) int {
+	return int(math.Max(float64(min), math.Min(v, float64(max))))
+}
+
+// boxCoverage averages the coverage of the source pixels which are scaled into a single pixel
+func boxCoverage(m Mask, r image.Rectangle) float64 {
+	sum := 0.
+	for x := r.Min.X; x < r.Max.X; x++ {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			sum += m.Coverage(x, y)
+		}
+	}
+
+	return sum / float64(r.Dx()*r.Dy())
+}
+
+// crop cuts the image to the bounds of the mask
+func crop(img image.Image, m Mask) image.Image {
+	if m == nil {
+		return img
+	}
+
+	if s, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(m.Bounds())
+	}
+
+	return img
+}
+
+type intersection []Mask
+
+// Intersect combines masks, a pixel's coverage is the product of its coverages,
+// nil masks are skipped
+func Intersect(masks ...Mask) Mask {
+	var result intersection
+	for _, m := range masks {
+		if m != nil {
+			result = append(result, m)
+		}
+	}
+
+	switch len(result) {
+	case 0:
+		return nil
+	case 1:
+		return result[0]
+	default:
+		return result
+	}
+}
+
+func (m intersection) Bounds() image.Rectangle {
+	b := m[0].Bounds()
+	for _, mask := range m[1:] {
+		b = b.Intersect(mask.Bounds())
+	}
+
+	return b
+}
+
+func (m intersection) Coverage(x, y int) float64 {
+	c := 1.
+	for _, mask := range m {
+		if c = c * mask.Coverage(x, y); c == 0 {
+			return 0
+		}
+	}
+
+	return c
+}
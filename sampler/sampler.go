@@ -0,0 +1,213 @@
+package sampler
+
+import (
+	"image"
+	"math"
+	"math/rand"
+
+	"github.com/nfnt/resize"
+	"github.com/simonmarton/common-colors/color"
+	"github.com/simonmarton/common-colors/models"
+)
+
+const defaultPixelBudget int = 32 * 32
+const defaultStrategy string = "resize"
+const defaultResizeFilter string = "lanczos"
+
+// Sampler picks the pixels of an image which are fed to the calculator,
+// with a non nil mask only the selected pixels are used, weighted by their coverage
+type Sampler interface {
+	Sample(img image.Image, mask Mask) []color.Color
+}
+
+// WithDefaults fills the unset sampling options of the config
+func WithDefaults(c models.CalculatorConfig) models.CalculatorConfig {
+	if c.PixelBudget <= 0 {
+		c.PixelBudget = defaultPixelBudget
+	}
+
+	if c.Sampling == "" {
+		c.Sampling = defaultStrategy
+	}
+
+	if c.ResizeFilter == "" {
+		c.ResizeFilter = defaultResizeFilter
+	}
+
+	return c
+}
+
+// New creates a Sampler from the sampling options of the config
+func New(c models.CalculatorConfig) Sampler {
+	c = WithDefaults(c)
+
+	switch c.Sampling {
+	case "grid":
+		return GridSampler{PixelBudget: c.PixelBudget}
+	case "random":
+		return RandomSampler{PixelBudget: c.PixelBudget, Seed: c.Seed}
+	case "none":
+		return AllSampler{}
+	default:
+		return ResizeSampler{PixelBudget: c.PixelBudget, Filter: c.ResizeFilter}
+	}
+}
+
+// ResizeSampler scales the image down to fit the pixel budget, keeping its aspect ratio
+type ResizeSampler struct {
+	PixelBudget int
+	// Filter is one of nearest, box, bilinear or lanczos
+	Filter string
+}
+
+// Sample ...
+func (s ResizeSampler) Sample(img image.Image, mask Mask) (result []color.Color) {
+	img = crop(img, mask)
+	b := img.Bounds()
+	width, height := targetSize(b.Dx(), b.Dy(), s.PixelBudget)
+
+	if width == b.Dx() && height == b.Dy() {
+		return AllSampler{}.Sample(img, mask)
+	}
+
+	var resized image.Image
+	switch s.Filter {
+	case "nearest":
+		resized = resize.Resize(uint(width), uint(height), img, resize.NearestNeighbor)
+	case "box":
+		resized = boxResize(img, width, height)
+	case "bilinear":
+		resized = resize.Resize(uint(width), uint(height), img, resize.Bilinear)
+	default:
+		resized = resize.Resize(uint(width), uint(height), img, resize.Lanczos3)
+	}
+
+	rb := resized.Bounds()
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			c := color.NewFromRGBA(resized.At(rb.Min.X+x, rb.Min.Y+y))
+
+			if mask != nil {
+				c.Weight = boxCoverage(mask, sourceRect(b, width, height, x, y))
+				if c.Weight == 0 {
+					continue
+				}
+			}
+
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+// GridSampler takes every n-th pixel in both directions
+type GridSampler struct {
+	PixelBudget int
+}
+
+// Sample ...
+func (s GridSampler) Sample(img image.Image, mask Mask) (result []color.Color) {
+	img = crop(img, mask)
+	b := img.Bounds()
+	step := stride(b.Dx(), b.Dy(), s.PixelBudget)
+
+	for x := b.Min.X; x < b.Max.X; x += step {
+		for y := b.Min.Y; y < b.Max.Y; y += step {
+			if c, ok := samplePixel(img, mask, x, y); ok {
+				result = append(result, c)
+			}
+		}
+	}
+
+	return result
+}
+
+// RandomSampler splits the image into a grid and takes one random pixel from each cell,
+// the same seed always yields the same pixels
+type RandomSampler struct {
+	PixelBudget int
+	Seed        int64
+}
+
+// Sample ...
+func (s RandomSampler) Sample(img image.Image, mask Mask) (result []color.Color) {
+	img = crop(img, mask)
+	b := img.Bounds()
+	step := stride(b.Dx(), b.Dy(), s.PixelBudget)
+	r := rand.New(rand.NewSource(s.Seed))
+
+	for x := b.Min.X; x < b.Max.X; x += step {
+		for y := b.Min.Y; y < b.Max.Y; y += step {
+			dx := r.Intn(min(step, b.Max.X-x))
+			dy := r.Intn(min(step, b.Max.Y-y))
+
+			if c, ok := samplePixel(img, mask, x+dx, y+dy); ok {
+				result = append(result, c)
+			}
+		}
+	}
+
+	return result
+}
+
+// AllSampler uses every pixel of the image without resizing
+type AllSampler struct{}
+
+// Sample ...
+func (s AllSampler) Sample(img image.Image, mask Mask) (result []color.Color) {
+	img = crop(img, mask)
+	b := img.Bounds()
+
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			if c, ok := samplePixel(img, mask, x, y); ok {
+				result = append(result, c)
+			}
+		}
+	}
+
+	return result
+}
+
+// samplePixel returns the color of a pixel weighted by the mask, false if it's not selected
+func samplePixel(img image.Image, mask Mask, x, y int) (color.Color, bool) {
+	c := color.NewFromRGBA(img.At(x, y))
+
+	if mask != nil {
+		c.Weight = mask.Coverage(x, y)
+	}
+
+	return c, c.Weight > 0
+}
+
+// targetSize scales width and height to fit into budget pixels without changing the aspect ratio,
+// images already within the budget are left as is
+func targetSize(width, height, budget int) (int, int) {
+	if width*height <= budget {
+		return width, height
+	}
+
+	scale := math.Sqrt(float64(budget) / float64(width*height))
+	w := max(1, int(float64(width)*scale))
+	h := max(1, int(float64(height)*scale))
+
+	// Very thin images, the short side can't shrink below one pixel
+	if w == 1 {
+		h = min(height, budget)
+	}
+	if h == 1 {
+		w = min(width, budget)
+	}
+
+	return w, h
+}
+
+// stride is the distance between sampled pixels so that about budget pixels are taken
+func stride(width, height, budget int) int {
+	if width*height <= budget {
+		return 1
+	}
+
+	return int(math.Ceil(math.Sqrt(float64(width*height) / float64(budget))))
+}
@@ -0,0 +1,217 @@
+package sampler
+
+import (
+	"image"
+	imagecolor "image/color"
+	"math"
+	"testing"
+
+	"github.com/simonmarton/common-colors/models"
+)
+
+func testImage(width, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, imagecolor.NRGBA{R: uint8(x), G: uint8(y), B: 0, A: 255})
+		}
+	}
+
+	return img
+}
+
+func TestNewWithDefaults(t *testing.T) {
+	s, ok := New(models.CalculatorConfig{}).(ResizeSampler)
+	if !ok {
+		t.Fatalf("Expected default ResizeSampler")
+	}
+
+	if s.PixelBudget != defaultPixelBudget {
+		t.Errorf("Expected default pixel budget %d, got %d", defaultPixelBudget, s.PixelBudget)
+	}
+
+	if s.Filter != defaultResizeFilter {
+		t.Errorf("Expected default filter %s, got %s", defaultResizeFilter, s.Filter)
+	}
+}
+
+func TestTargetSize(t *testing.T) {
+	var sizeTests = []struct {
+		width, height, budget int
+		expectedW, expectedH  int
+	}{
+		{16, 16, 1024, 16, 16},
+		{64, 64, 1024, 32, 32},
+		{200, 50, 1024, 64, 16},
+		{10000, 1, 100, 100, 1},
+	}
+
+	for _, tt := range sizeTests {
+		w, h := targetSize(tt.width, tt.height, tt.budget)
+		if w != tt.expectedW || h != tt.expectedH {
+			t.Errorf("targetSize error for %dx%d, expected %dx%d, got %dx%d", tt.width, tt.height, tt.expectedW, tt.expectedH, w, h)
+		}
+	}
+}
+
+func TestGridSampler(t *testing.T) {
+	colors := GridSampler{PixelBudget: 16}.Sample(testImage(8, 8), nil)
+
+	if len(colors) != 16 {
+		t.Fatalf("Expected 16 colors, got %d", len(colors))
+	}
+
+	if colors[1].G != 2 {
+		t.Errorf("Expected every second pixel, got G %d", colors[1].G)
+	}
+}
+
+func TestRandomSampler(t *testing.T) {
+	img := testImage(30, 30)
+	c1 := RandomSampler{PixelBudget: 100, Seed: 42}.Sample(img, nil)
+	c2 := RandomSampler{PixelBudget: 100, Seed: 42}.Sample(img, nil)
+
+	if len(c1) != 100 {
+		t.Fatalf("Expected 100 colors, got %d", len(c1))
+	}
+
+	for i := range c1 {
+		if c1[i] != c2[i] {
+			t.Fatalf("Expected same colors for the same seed at %d", i)
+		}
+	}
+}
+
+func TestAllSampler(t *testing.T) {
+	colors := AllSampler{}.Sample(testImage(40, 30), nil)
+
+	if len(colors) != 1200 {
+		t.Errorf("Expected 1200 colors, got %d", len(colors))
+	}
+}
+
+func TestBoxResize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, imagecolor.NRGBA{R: 200, A: 255})
+	img.Set(1, 0, imagecolor.NRGBA{R: 100, A: 255})
+	img.Set(0, 1, imagecolor.NRGBA{R: 0, G: 255, A: 0})
+	img.Set(1, 1, imagecolor.NRGBA{R: 0, G: 255, A: 0})
+
+	got := imagecolor.NRGBAModel.Convert(boxResize(img, 1, 1).At(0, 0)).(imagecolor.NRGBA)
+
+	// Transparent pixels only lower the alpha
+	if got.R != 150 || got.G != 0 || got.A != 127 {
+		t.Errorf("boxResize error, got %v", got)
+	}
+}
+
+func TestMaskRect(t *testing.T) {
+	img := testImage(10, 10)
+	mask := NewMask(models.Selection{Rect: &models.Rect{X: 2, Y: 0, Width: 3, Height: 20}}, img.Bounds())
+
+	colors := AllSampler{}.Sample(img, mask)
+	if len(colors) != 30 {
+		t.Fatalf("Expected 30 colors, got %d", len(colors))
+	}
+
+	if colors[0].R != 2 {
+		t.Errorf("Expected first column 2, got %d", colors[0].R)
+	}
+}
+
+func TestMaskPolygon(t *testing.T) {
+	img := testImage(10, 10)
+	// Lower left half of the image
+	triangle := []models.Point{{X: 0, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}}
+	mask := NewMask(models.Selection{Polygons: [][]models.Point{triangle}}, img.Bounds())
+
+	colors := AllSampler{}.Sample(img, mask)
+	if len(colors) != 45 {
+		t.Fatalf("Expected 45 colors, got %d", len(colors))
+	}
+
+	for _, c := range colors {
+		if c.R >= c.G {
+			t.Errorf("Expected pixels below the diagonal, got %d, %d", c.R, c.G)
+		}
+	}
+}
+
+func TestMaskRasterize(t *testing.T) {
+	// Overlapping, concave and off the image, with fractional points and an offset image
+	polygons := [][]models.Point{
+		{{X: 1.5, Y: 0}, {X: 18.2, Y: 3.7}, {X: 9, Y: 9}, {X: 17, Y: 19.5}, {X: 0.3, Y: 15}},
+		{{X: 10, Y: -5}, {X: 25, Y: 10}, {X: 10, Y: 25}, {X: 12, Y: 10}},
+	}
+	bounds := image.Rect(3, 4, 23, 24)
+	mask := NewMask(models.Selection{Polygons: polygons}, bounds)
+
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			px, py := float64(x-bounds.Min.X)+.5, float64(y-bounds.Min.Y)+.5
+			expected := polygonContains(polygons[0], px, py) || polygonContains(polygons[1], px, py)
+
+			if got := mask.Coverage(x, y) == 1; got != expected {
+				t.Errorf("Coverage of %d, %d error, expected inside %v", x, y, expected)
+			}
+		}
+	}
+}
+
+// polygonContains is an even-odd rule point in polygon test
+func polygonContains(polygon []models.Point, x, y float64) bool {
+	inside := false
+
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+
+		if (a.Y > y) != (b.Y > y) && x < (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+func TestMaskImage(t *testing.T) {
+	img := testImage(10, 10)
+	// Half sized mask, white on the left, half transparent white on the right
+	maskImg := image.NewNRGBA(image.Rect(0, 0, 5, 5))
+	for x := 0; x < 5; x++ {
+		for y := 0; y < 5; y++ {
+			a := uint8(255)
+			if x >= 3 {
+				a = 0
+			} else if x == 2 {
+				a = 51
+			}
+			maskImg.Set(x, y, imagecolor.NRGBA{R: 255, G: 255, B: 255, A: a})
+		}
+	}
+	mask := NewMask(models.Selection{Mask: maskImg}, img.Bounds())
+
+	colors := AllSampler{}.Sample(img, mask)
+	if len(colors) != 60 {
+		t.Fatalf("Expected 60 colors, got %d", len(colors))
+	}
+
+	if w := colors[len(colors)-1].Weight; math.Abs(w-.2) > .001 {
+		t.Errorf("Expected weight .2, got %.4f", w)
+	}
+}
+
+func TestResizeSamplerMask(t *testing.T) {
+	img := testImage(64, 64)
+	mask := NewMask(models.Selection{Rect: &models.Rect{X: 0, Y: 0, Width: 64, Height: 16}}, img.Bounds())
+
+	colors := ResizeSampler{PixelBudget: 64, Filter: "box"}.Sample(img, mask)
+	if len(colors) != 64 {
+		t.Fatalf("Expected 64 colors, got %d", len(colors))
+	}
+
+	for _, c := range colors {
+		if c.G >= 16 || c.Weight != 1 {
+			t.Errorf("Expected colors from the top strip only, got %v", c)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simonmarton/common-colors/logging"
+)
+
+// maxSignatureAge is how far the X-Timestamp of a signed request can be from the server clock
+const maxSignatureAge = 5 * time.Minute
+
+// apiKeys are the clients allowed to use the API, by key ID
+type apiKeys struct {
+	secrets map[string]string
+	// ids are looked up by the hash of the key so the lookup doesn't leak the key through timing
+	ids map[[sha256.Size]byte]string
+}
+
+// loadAPIKeys reads a file of "id key" lines, empty lines and lines starting with # are skipped
+func loadAPIKeys(path string) (*apiKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &apiKeys{secrets: map[string]string{}, ids: map[[sha256.Size]byte]string{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid line %d in %s, expected an ID and a key", n, path)
+		}
+
+		id, key := fields[0], fields[1]
+		if _, ok := keys.secrets[id]; ok {
+			return nil, fmt.Errorf("Duplicate key ID %s in %s", id, path)
+		}
+
+		keys.secrets[id] = key
+		keys.ids[sha256.Sum256([]byte(key))] = id
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(keys.secrets) == 0 {
+		return nil, fmt.Errorf("No API keys in %s", path)
+	}
+
+	return keys, nil
+}
+
+// authenticate returns the key ID of a request, which either has one of the keys in X-API-Key or
+// an Authorization: Bearer header, or is signed with one as described at signaturePayload
+func (k *apiKeys) authenticate(r *http.Request, now time.Time) (string, error) {
+	if signature := r.Header.Get("X-Signature"); signature != "" {
+		return k.verify(r, signature, now)
+	}
+
+	key := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && key == "" {
+		key = strings.TrimSpace(bearer)
+	}
+
+	return k.lookup(key)
+}
+
+// lookup returns the ID of a key
+func (k *apiKeys) lookup(key string) (string, error) {
+	if key == "" {
+		return "", unauthorized("Missing API key")
+	}
+
+	id, ok := k.ids[sha256.Sum256([]byte(key))]
+	if !ok {
+		return "", unauthorized("Invalid API key")
+	}
+
+	return id, nil
+}
+
+func (k *apiKeys) verify(r *http.Request, signature string, now time.Time) (string, error) {
+	id := r.Header.Get("X-Key-ID")
+	secret, ok := k.secrets[id]
+	if !ok {
+		return "", unauthorized("Invalid X-Key-ID")
+	}
+
+	timestamp := r.Header.Get("X-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", unauthorized("Invalid X-Timestamp")
+	}
+
+	if age := now.Sub(time.Unix(unix, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return "", unauthorized("Expired X-Timestamp")
+	}
+
+	// The body is read to check the signature and replayed for the handler,
+	// its size is already limited by MaxUploadSize
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	expected := sign(secret, signaturePayload(r.Method, r.URL.RequestURI(), timestamp, body))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "", unauthorized("Invalid X-Signature")
+	}
+
+	return id, nil
+}
+
+// signaturePayload is signed with HMAC-SHA256 in the X-Signature header of a request:
+// the method, the path with the query and X-Timestamp on separate lines, followed by the body
+func signaturePayload(method, uri, timestamp string, body []byte) []byte {
+	return append([]byte(method+"\n"+uri+"\n"+timestamp+"\n"), body...)
+}
+
+// sign returns the X-Signature value of a payload: "sha256=" followed by the hex HMAC-SHA256
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func unauthorized(message string) *APIError {
+	return &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: message}
+}
+
+// requireKey rejects requests without a valid API key or signature
+// and adds the key ID to the logger of the request
+func requireKey(keys *apiKeys, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := keys.authenticate(r, time.Now())
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="common-colors"`)
+			writeError(w, r, err)
+			return
+		}
+
+		ctx := logging.NewContext(r.Context(), logging.FromContext(r.Context()).With("client", id))
+		next.ServeHTTP(w, r.WithContext(withClient(ctx, id)))
+	})
+}
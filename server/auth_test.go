@@ -0,0 +1,118 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonmarton/common-colors/logging"
+)
+
+func TestAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(path, []byte("# partners\npartner-a secret-a\n\npartner-b secret-b\n"), 0600)
+
+	keys, err := loadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	body := `{"url":"https://example.com/icon.png"}`
+	signed := func(id, secret string, at time.Time) *http.Request {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		r := httptest.NewRequest("POST", "/api/url?stream=ndjson", strings.NewReader(body))
+		r.Header.Set("X-Key-ID", id)
+		r.Header.Set("X-Timestamp", timestamp)
+		r.Header.Set("X-Signature", sign(secret, signaturePayload("POST", "/api/url?stream=ndjson", timestamp, []byte(body))))
+		return r
+	}
+	withHeader := func(key, value string) *http.Request {
+		r := httptest.NewRequest("POST", "/api/url", strings.NewReader(body))
+		r.Header.Set(key, value)
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		request  *http.Request
+		expected string
+	}{
+		{"API key", withHeader("X-API-Key", "secret-b"), "partner-b"},
+		{"bearer", withHeader("Authorization", "Bearer secret-a"), "partner-a"},
+		{"invalid key", withHeader("X-API-Key", "partner-a"), ""},
+		{"no key", httptest.NewRequest("POST", "/api/url", nil), ""},
+		{"signed", signed("partner-a", "secret-a", now.Add(-time.Minute)), "partner-a"},
+		{"wrong secret", signed("partner-a", "secret-b", now), ""},
+		{"unknown ID", signed("partner-c", "secret-a", now), ""},
+		{"expired", signed("partner-a", "secret-a", now.Add(-time.Hour)), ""},
+	}
+
+	for _, test := range tests {
+		id, err := keys.authenticate(test.request, now)
+		if id != test.expected {
+			t.Errorf("authenticate %s error, expected %q, got %q (%v)", test.name, test.expected, id, err)
+		}
+
+		if test.expected == "" && toAPIError(err).Status != http.StatusUnauthorized {
+			t.Errorf("authenticate %s error, expected 401, got %v", test.name, err)
+		}
+	}
+
+	// The handler can still read the signed body
+	r := signed("partner-a", "secret-a", now)
+	keys.authenticate(r, now)
+	if b, _ := io.ReadAll(r.Body); string(b) != body {
+		t.Errorf("Expected the body after the signature check, got %s", b)
+	}
+}
+
+func TestLoadAPIKeysErrors(t *testing.T) {
+	for _, content := range []string{"", "only-id\n", "a key-1\na key-2\n"} {
+		path := filepath.Join(t.TempDir(), "keys")
+		os.WriteFile(path, []byte(content), 0600)
+
+		if _, err := loadAPIKeys(path); err == nil {
+			t.Errorf("Expected error for keys file %q", content)
+		}
+	}
+}
+
+func TestFailedKeysRateLimited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(path, []byte("partner-a secret-a\n"), 0600)
+
+	s, err := New(&fakeHandler{}, Config{Logger: logging.Discard, DisableStatic: true, JobsDir: t.TempDir(), APIKeysFile: path, RateLimit: 60, RateBurst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(key string) int {
+		r := httptest.NewRequest("POST", "/api/v1/url", strings.NewReader(`{"url": "http://a"}`))
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := request("guess"); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a wrong key, got %d", code)
+		}
+	}
+
+	if code := request("guess"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for wrong keys over the rate limit, got %d", code)
+	}
+
+	// The valid key is counted against the same IP before authentication
+	if code := request("secret-a"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 from the IP over the rate limit, got %d", code)
+	}
+}
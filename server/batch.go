@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/simonmarton/common-colors/logging"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+const defaultMaxMemory = 32 << 20
+
+// BatchReq format of JSON batch requests
+type BatchReq struct {
+	URLs      []string                `json:"urls"`
+	Config    models.CalculatorConfig `json:"config"`
+	Selection models.Selection        `json:"selection"`
+}
+
+// BatchResp format
+type BatchResp struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchItem is the result or the error of one image in a batch
+type BatchItem struct {
+	Index  int               `json:"index"`
+	Name   string            `json:"name"`
+	Result *CommonColorsResp `json:"result,omitempty"`
+	Error  *APIError         `json:"error,omitempty"`
+}
+
+// batchInput is either an uploaded file, the bytes of an image or a URL
+type batchInput struct {
+	name      string
+	file      *multipart.FileHeader
+	data      []byte
+	imageType string
+	url       string
+}
+
+// parseBatch reads a multipart form with image files and url values or a JSON BatchReq
+func parseBatch(r *http.Request) (inputs []batchInput, config models.CalculatorConfig, selection models.Selection, err error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		var req BatchReq
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, config, selection, fieldError("body", err)
+		}
+
+		for _, u := range req.URLs {
+			inputs = append(inputs, batchInput{name: u, url: u})
+		}
+
+		if err = checkConfig(req.Config); err != nil {
+			return nil, config, selection, err
+		}
+
+		return inputs, req.Config, req.Selection, checkSelection(req.Selection)
+	}
+
+	if err = r.ParseMultipartForm(defaultMaxMemory); err != nil {
+		return nil, config, selection, fieldError("body", err)
+	}
+
+	if v := r.FormValue("config"); v != "" {
+		if err = json.Unmarshal([]byte(v), &config); err != nil {
+			return nil, config, selection, fieldError("config", err)
+		}
+
+		if err = checkConfig(config); err != nil {
+			return nil, config, selection, err
+		}
+	}
+
+	// The mask is skipped, it rarely fits every image of a batch
+	if v := r.FormValue("selection"); v != "" {
+		if err = json.Unmarshal([]byte(v), &selection); err != nil {
+			return nil, config, selection, fieldError("selection", err)
+		}
+
+		if err = checkSelection(selection); err != nil {
+			return nil, config, selection, err
+		}
+	}
+
+	for _, f := range r.MultipartForm.File["image"] {
+		inputs = append(inputs, batchInput{name: f.Filename, file: f})
+	}
+
+	for _, u := range r.MultipartForm.Value["url"] {
+		inputs = append(inputs, batchInput{name: u, url: u})
+	}
+
+	return inputs, config, selection, nil
+}
+
+// processBatch runs the inputs on at most workers goroutines and calls emit with every item
+// as soon as it's done, emit is never called concurrently
+func processBatch(ctx context.Context, h APIHandler, inputs []batchInput, config models.CalculatorConfig, opts pipeline.Options, workers int, emit func(BatchItem)) {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				item := processItem(ctx, h, inputs[i], config, opts)
+				item.Index = i
+
+				mu.Lock()
+				emit(item)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range inputs {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+}
+
+// processItem turns the error or the panic of the handler into the error of the item,
+// a panic of one image doesn't take the others or the server down
+func processItem(ctx context.Context, h APIHandler, in batchInput, config models.CalculatorConfig, opts pipeline.Options) (item BatchItem) {
+	item.Name = in.name
+
+	defer func() {
+		if v := recover(); v != nil {
+			logging.Or(opts.Logger).Error("Batch item panicked", "name", in.name, "panic", v, "stack", string(debug.Stack()))
+			item.Result = nil
+			item.Error = &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error"}
+			errorsTotal.Inc(item.Error.Code)
+		}
+	}()
+
+	var result CommonColorsResp
+	var err error
+
+	switch {
+	case in.file != nil:
+		var f multipart.File
+		f, err = in.file.Open()
+		if err == nil {
+			defer f.Close()
+			result, err = h.ProcessImage(f, in.file.Header.Get("Content-Type"), config, opts)
+		}
+	case in.data != nil:
+		result, err = h.ProcessImage(bytes.NewReader(in.data), in.imageType, config, opts)
+	default:
+		result, err = h.ProcessURL(ctx, in.url, config, opts)
+	}
+
+	if err != nil {
+		item.Error = toAPIError(err)
+		errorsTotal.Inc(item.Error.Code)
+		return item
+	}
+
+	item.Result = &result
+
+	return item
+}
+
+func handleBatch(h APIHandler, workers int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+
+		inputs, config, selection, err := parseBatch(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		_, withSteps := r.URL.Query()["steps"]
+
+		if s := newStream(w, r); s != nil {
+			processBatch(r.Context(), h, inputs, config, requestOptions(r, selection, withSteps), workers, func(item BatchItem) {
+				s.send("item", item)
+			})
+			s.send("done", nil)
+			return
+		}
+
+		resp := BatchResp{Items: make([]BatchItem, len(inputs))}
+		for i, in := range inputs {
+			// Left like this if the request is canceled before the item is picked up
+			resp.Items[i] = BatchItem{Index: i, Name: in.name, Error: &APIError{Code: CodeCanceled, Message: "Not processed"}}
+		}
+		processBatch(r.Context(), h, inputs, config, requestOptions(r, selection, withSteps), workers, func(item BatchItem) {
+			resp.Items[item.Index] = item
+		})
+
+		writeJSON(w, resp)
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+type fakeHandler struct {
+	running, maxRunning int32
+}
+
+func (h *fakeHandler) track() func() {
+	n := atomic.AddInt32(&h.running, 1)
+	for {
+		m := atomic.LoadInt32(&h.maxRunning)
+		if n <= m || atomic.CompareAndSwapInt32(&h.maxRunning, m, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	return func() { atomic.AddInt32(&h.running, -1) }
+}
+
+func (h *fakeHandler) ProcessImage(file io.Reader, imageType string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error) {
+	defer h.track()()
+
+	if opts.OnStep != nil {
+		opts.OnStep([]models.ColorStepResp{{R: 1, Weight: 1}})
+	}
+
+	data, _ := io.ReadAll(file)
+	if string(data) == "panic" {
+		panic("Not supported Algorithm")
+	}
+	if string(data) == "broken" {
+		return CommonColorsResp{}, &pipeline.DecodeError{Err: errors.New("broken")}
+	}
+
+	return CommonColorsResp{Gradient: []string{string(data)}}, nil
+}
+
+func (h *fakeHandler) ProcessURL(ctx context.Context, url string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error) {
+	defer h.track()()
+
+	return CommonColorsResp{Gradient: []string{url}}, nil
+}
+
+func TestBatchMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, content := range []string{"a", "broken", "c"} {
+		fw, _ := mw.CreateFormFile("image", content+".png")
+		fw.Write([]byte(content))
+	}
+	mw.WriteField("url", "http://example.com/d.png")
+	mw.WriteField("config", `{"iterationCount": 3}`)
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/api/batch", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	h := &fakeHandler{}
+	handleBatch(h, 2)(w, r)
+
+	var resp BatchResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Items) != 4 {
+		t.Fatalf("Expected 4 items, got %d", len(resp.Items))
+	}
+
+	expected := []string{"a", "", "c", "http://example.com/d.png"}
+	for i, item := range resp.Items {
+		if item.Index != i {
+			t.Errorf("Expected item %d in order, got %d", i, item.Index)
+		}
+
+		if expected[i] == "" {
+			if item.Error == nil || item.Error.Code != CodeInvalidImage {
+				t.Errorf("Expected item %d to fail, got %+v", i, item)
+			}
+			continue
+		}
+
+		if item.Result == nil || item.Result.Gradient[0] != expected[i] {
+			t.Errorf("Expected item %d result %s, got %+v", i, expected[i], item)
+		}
+	}
+
+	if h.maxRunning > 2 {
+		t.Errorf("Expected at most 2 workers, got %d", h.maxRunning)
+	}
+}
+
+func TestBatchJSON(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/batch", bytes.NewBufferString(`{"urls": ["http://a", "http://b"]}`))
+	w := httptest.NewRecorder()
+	handleBatch(&fakeHandler{}, 1)(w, r)
+
+	var resp BatchResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Items) != 2 || resp.Items[1].Result == nil || resp.Items[1].Result.Gradient[0] != "http://b" {
+		t.Errorf("Expected a result per URL, got %+v", resp.Items)
+	}
+}
+
+func TestBatchPanic(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, content := range []string{"a", "panic"} {
+		fw, _ := mw.CreateFormFile("image", content+".png")
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/api/batch", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	handleBatch(&fakeHandler{}, 2)(w, r)
+
+	var resp BatchResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Items) != 2 || resp.Items[0].Result == nil {
+		t.Fatalf("Expected the other item to be processed, got %+v", resp.Items)
+	}
+
+	if resp.Items[1].Error == nil || resp.Items[1].Error.Code != CodeInternal {
+		t.Errorf("Expected an internal error for the panic, got %+v", resp.Items[1])
+	}
+}
+
+func TestBatchInvalidConfig(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("image", "a.png")
+	fw.Write([]byte("a"))
+	mw.WriteField("config", `{"algorithm": "nope"}`)
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/api/batch", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	h := &fakeHandler{}
+	handleBatch(h, 1)(w, r)
+
+	var resp ErrorResp
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if w.Code != 400 || resp.Error == nil || resp.Error.Code != CodeInvalidRequest || resp.Error.Field != "config" {
+		t.Errorf("Expected an invalid config error, got %d %s", w.Code, w.Body.String())
+	}
+
+	if h.maxRunning != 0 {
+		t.Errorf("Expected no image to be processed")
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+const (
+	defaultCacheSize = 64 << 20
+	defaultCacheTTL  = 24 * time.Hour
+)
+
+// resultETag addresses a result by the hash of the uploaded image, the mask
+// and the normalized parameters, so equal inputs get the same tag
+func resultETag(body []byte, maskSum string, config models.CalculatorConfig, selection models.Selection, withSteps bool) string {
+	params, _ := json.Marshal(struct {
+		Config    models.CalculatorConfig
+		Selection models.Selection
+		Mask      string
+		WithSteps bool
+	}{pipeline.Normalize(config), selection, maskSum, withSteps})
+
+	h := sha256.New()
+	bodySum := sha256.Sum256(body)
+	h.Write(bodySum[:])
+	h.Write(params)
+
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// etagMatch tells whether an If-None-Match header matches the etag
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/simonmarton/common-colors/models"
+)
+
+func TestResultETag(t *testing.T) {
+	body := []byte("image")
+	etag := resultETag(body, "", models.CalculatorConfig{}, models.Selection{}, false)
+
+	// Explicit defaults address the same result
+	if other := resultETag(body, "", models.CalculatorConfig{PixelBudget: 1024}, models.Selection{}, false); other != etag {
+		t.Errorf("Expected normalized configs to match, got %s and %s", etag, other)
+	}
+
+	if other := resultETag(body, "", models.CalculatorConfig{}, models.Selection{}, true); other == etag {
+		t.Errorf("Expected steps to change the etag")
+	}
+
+	if other := resultETag([]byte("other"), "", models.CalculatorConfig{}, models.Selection{}, false); other == etag {
+		t.Errorf("Expected the body to change the etag")
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	var matchTests = []struct {
+		header string
+		match  bool
+	}{
+		{`"a"`, true},
+		{`"b", "a"`, true},
+		{`W/"a"`, true},
+		{`*`, true},
+		{`"b"`, false},
+		{``, false},
+	}
+
+	for _, tt := range matchTests {
+		if etagMatch(tt.header, `"a"`) != tt.match {
+			t.Errorf("etagMatch error, expected %v for %s", tt.match, tt.header)
+		}
+	}
+}
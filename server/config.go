@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config of the server, every field can be set in a YAML or TOML file, with an environment
+// variable and with a flag, see LoadConfig. Zero values are replaced with defaults by New.
+type Config struct {
+	Addr            string        `config:"addr" env:"ADDR" usage:"listen address"`
+	GRPCAddr        string        `config:"grpc-addr" env:"GRPC_ADDR" usage:"listen address of the gRPC service, off if empty"`
+	ReadTimeout     time.Duration `config:"read-timeout" env:"READ_TIMEOUT" usage:"limit of reading a request"`
+	WriteTimeout    time.Duration `config:"write-timeout" env:"WRITE_TIMEOUT" usage:"limit of writing a response, includes streams"`
+	IdleTimeout     time.Duration `config:"idle-timeout" env:"IDLE_TIMEOUT" usage:"keep-alive timeout"`
+	ShutdownTimeout time.Duration `config:"shutdown-timeout" env:"SHUTDOWN_TIMEOUT" usage:"time to drain requests on SIGTERM"`
+	MaxUploadSize   int64         `config:"max-upload-size" env:"MAX_UPLOAD_SIZE" usage:"request body limit in bytes"`
+	MaxPixels       int           `config:"max-pixels" env:"MAX_PIXELS" usage:"width times height limit of images, checked before decoding"`
+	MaxFrames       int           `config:"max-frames" env:"MAX_FRAMES" usage:"frame limit of animated images"`
+	DecodeTimeout   time.Duration `config:"decode-timeout" env:"DECODE_TIMEOUT" usage:"limit of decoding an image"`
+	MaxPixelBudget  int           `config:"max-pixel-budget" env:"MAX_PIXEL_BUDGET" usage:"most pixels sampled for clustering, caps pixelBudget and sampling none of requests"`
+
+	AllowedHosts         string        `config:"allowed-hosts" env:"ALLOWED_HOSTS" usage:"comma separated hosts image and callback URLs are restricted to, *.example.com matches subdomains, any if empty"`
+	DeniedHosts          string        `config:"denied-hosts" env:"DENIED_HOSTS" usage:"comma separated hosts which are never requested"`
+	AllowPrivateNetworks bool          `config:"allow-private-networks" env:"ALLOW_PRIVATE_NETWORKS" usage:"allow URLs of private, loopback and link-local addresses, only for trusted clients"`
+	FetchTimeout         time.Duration `config:"fetch-timeout" env:"FETCH_TIMEOUT" usage:"limit of downloading an image from a URL"`
+
+	StaticDir     string `config:"static-dir" env:"STATIC_DIR" usage:"serve the web pages from this directory instead of the embedded ones, for development"`
+	DisableStatic bool   `config:"disable-static" env:"DISABLE_STATIC" usage:"only serve the API"`
+
+	TLSCert string `config:"tls-cert" env:"TLS_CERT" usage:"certificate file, serves HTTPS with tls-key"`
+	TLSKey  string `config:"tls-key" env:"TLS_KEY" usage:"private key file"`
+
+	CacheSize    int64         `config:"cache-size" env:"CACHE_SIZE" usage:"memory limit of the result cache in bytes"`
+	CacheTTL     time.Duration `config:"cache-ttl" env:"CACHE_TTL" usage:"lifetime of cached results"`
+	CacheDir     string        `config:"cache-dir" env:"CACHE_DIR" usage:"directory of the disk result cache, off if empty"`
+	CacheDirSize int64         `config:"cache-dir-size" env:"CACHE_DIR_SIZE" usage:"size limit of the disk cache in bytes"`
+
+	BatchWorkers  int           `config:"batch-workers" env:"BATCH_WORKERS" usage:"images of a batch processed at the same time"`
+	JobWorkers    int           `config:"job-workers" env:"JOB_WORKERS" usage:"jobs processed at the same time"`
+	JobsDir       string        `config:"jobs-dir" env:"JOBS_DIR" usage:"directory of the job store"`
+	JobRetention  time.Duration `config:"job-retention" env:"JOB_RETENTION" usage:"how long finished jobs and their images are kept"`
+	WebhookSecret string        `config:"webhook-secret" env:"WEBHOOK_SECRET" usage:"HMAC key of job callbacks, jobs with a callbackUrl are rejected without it"`
+
+	APIKeysFile   string `config:"api-keys-file" env:"API_KEYS_FILE" usage:"file of \"id key\" lines, the API requires one of the keys or a request signed with it when set"`
+	RateLimit     int    `config:"rate-limit" env:"RATE_LIMIT" usage:"API requests per minute per key and per IP, off if 0"`
+	RateBurst     int    `config:"rate-burst" env:"RATE_BURST" usage:"requests allowed at once above the rate limit, rate-limit if 0"`
+	MaxConcurrent int    `config:"max-concurrent" env:"MAX_CONCURRENT" usage:"API requests in progress per key or IP, off if 0"`
+	TrustProxy    bool   `config:"trust-proxy" env:"TRUST_PROXY" usage:"take the client IP from the last X-Forwarded-For address"`
+
+	CORSOrigins     string        `config:"cors-origins" env:"CORS_ORIGINS" usage:"comma separated origins allowed to call the API, exact, wildcard subdomains like https://*.example.com or * for any"`
+	CORSMethods     string        `config:"cors-methods" env:"CORS_METHODS" usage:"comma separated methods allowed in preflight requests"`
+	CORSHeaders     string        `config:"cors-headers" env:"CORS_HEADERS" usage:"comma separated request headers allowed in preflight requests, * for any"`
+	CORSCredentials bool          `config:"cors-credentials" env:"CORS_CREDENTIALS" usage:"allow cookies and authorization headers from the allowed origins, needs a list of cors-origins"`
+	CORSMaxAge      time.Duration `config:"cors-max-age" env:"CORS_MAX_AGE" usage:"how long browsers can cache preflight responses"`
+
+	LogLevel  string `config:"log-level" env:"LOG_LEVEL" usage:"debug, info, warn or error"`
+	LogFormat string `config:"log-format" env:"LOG_FORMAT" usage:"text or json"`
+	// Logger is used instead of creating one from LogLevel and LogFormat when set
+	Logger *slog.Logger `config:"-"`
+}
+
+// LoadConfig reads the config from the file given with -config or CONFIG_FILE, the environment
+// and the flags in args, later ones override the earlier
+func LoadConfig(args []string) (Config, error) {
+	var c Config
+	v := reflect.ValueOf(&c).Elem()
+	t := v.Type()
+
+	fs := flag.NewFlagSet("common-colors", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file")
+
+	flags := map[string]*string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if key := f.Tag.Get("config"); key != "-" {
+			flags[key] = fs.String(key, "", f.Tag.Get("usage"))
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+
+	if *file != "" {
+		values, err := readConfigFile(*file)
+		if err != nil {
+			return c, err
+		}
+
+		for key, value := range values {
+			i := fieldByKey(t, key)
+			if i < 0 {
+				return c, fmt.Errorf("Unknown config key %s in %s", key, *file)
+			}
+
+			if err := setField(v.Field(i), value); err != nil {
+				return c, fmt.Errorf("Invalid %s in %s: %v", key, *file, err)
+			}
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("env") == "" {
+			continue
+		}
+
+		if value, ok := os.LookupEnv(f.Tag.Get("env")); ok {
+			if err := setField(v.Field(i), value); err != nil {
+				return c, fmt.Errorf("Invalid %s: %v", f.Tag.Get("env"), err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		i := fieldByKey(t, fl.Name)
+		if i < 0 || err != nil {
+			return
+		}
+
+		if setErr := setField(v.Field(i), *flags[fl.Name]); setErr != nil {
+			err = fmt.Errorf("Invalid -%s: %v", fl.Name, setErr)
+		}
+	})
+
+	return c, err
+}
+
+// fieldByKey finds the field of a config key, "read-timeout", "read_timeout" and "readTimeout" are the same
+func fieldByKey(t reflect.Type, key string) int {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s))
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("config"); tag != "-" && normalize(tag) == normalize(key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func setField(f reflect.Value, value string) error {
+	switch {
+	case f.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+	case f.Kind() == reflect.String:
+		f.SetString(value)
+	case f.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case f.Kind() == reflect.Int || f.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	default:
+		return fmt.Errorf("Not supported type %s", f.Type())
+	}
+
+	return nil
+}
+
+// readConfigFile parses the flat subset of YAML ("key: value") or TOML ("key = value") by the extension,
+// nested values are not supported
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sep := ":"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		sep = "="
+	default:
+		return nil, fmt.Errorf("Not supported config file format: %s", path)
+	}
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, sep)
+		if !ok || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "-") {
+			return nil, fmt.Errorf("Invalid line %d in %s: %s", n, path, line)
+		}
+
+		value, err = configValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid line %d in %s: %v", n, path, err)
+		}
+
+		values[strings.TrimSpace(key)] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// configValue unquotes a value and strips its trailing comment
+func configValue(value string) (string, error) {
+	if strings.HasPrefix(value, `"`) {
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			return "", fmt.Errorf("Invalid string %s", value)
+		}
+		return strconv.Unquote(quoted)
+	}
+
+	if strings.HasPrefix(value, "'") {
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("Unterminated string %s", value)
+		}
+		return value[1 : end+1], nil
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+
+	return strings.TrimSpace(value), nil
+}
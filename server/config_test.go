@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simonmarton/common-colors/logging"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestLoadConfig(t *testing.T) {
+	yaml := writeConfig(t, "config.yaml", `
+# Server
+addr: ":9000"
+read_timeout: 10s
+writeTimeout: 1m # streams
+max-upload-size: 1024
+disable-static: true
+webhook-secret: 'se#cret'
+static-dir: "web \"pages\""
+`)
+
+	t.Setenv("MAX_UPLOAD_SIZE", "2048")
+	c, err := LoadConfig([]string{"-config", yaml, "-addr", ":9001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Config{
+		Addr:          ":9001",
+		ReadTimeout:   10 * time.Second,
+		WriteTimeout:  time.Minute,
+		MaxUploadSize: 2048,
+		DisableStatic: true,
+		WebhookSecret: "se#cret",
+		StaticDir:     `web "pages"`,
+	}
+	if c != expected {
+		t.Errorf("LoadConfig error, expected %+v, got %+v", expected, c)
+	}
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	toml := writeConfig(t, "config.toml", "addr = \":9000\"\nbatch-workers = 3\n")
+	t.Setenv("CONFIG_FILE", toml)
+
+	c, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Addr != ":9000" || c.BatchWorkers != 3 {
+		t.Errorf("Expected TOML values, got %+v", c)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	var errorTests = []struct {
+		name, content string
+		args          []string
+	}{
+		{"unknown.yaml", "port: 80\n", nil},
+		{"nested.toml", "[server]\naddr = \":80\"\n", nil},
+		{"duration.yaml", "read-timeout: 10\n", nil},
+		{"ok.yaml", "addr: :80\n", []string{"-batch-workers", "many"}},
+		{"config.json", "{}", nil},
+	}
+
+	for _, tt := range errorTests {
+		p := writeConfig(t, tt.name, tt.content)
+		if _, err := LoadConfig(append([]string{"-config", p}, tt.args...)); err == nil {
+			t.Errorf("Expected error for %s", tt.name)
+		}
+	}
+}
+
+func TestRunShutdown(t *testing.T) {
+	s, err := New(&fakeHandler{}, Config{Logger: logging.Discard, Addr: "127.0.0.1:0", DisableStatic: true, JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run didn't return after the context was canceled")
+	}
+}
+
+func TestRunJobsFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "jobs")
+	s, err := New(&fakeHandler{}, Config{Logger: logging.Discard, Addr: "127.0.0.1:0", DisableStatic: true, JobsDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The queue can't resume without its store, a broken job file is only skipped
+	os.RemoveAll(dir)
+
+	done := make(chan error)
+	go func() { done <- s.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Expected the error of the jobs")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run didn't stop without the jobs")
+	}
+}
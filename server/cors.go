@@ -0,0 +1,166 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCORSOrigins = "*"
+	defaultCORSMethods = "GET, POST, DELETE"
+	defaultCORSHeaders = "Content-Type, Authorization, If-None-Match, X-API-Key, X-Key-ID, X-Timestamp, X-Signature, X-Request-ID"
+	defaultCORSMaxAge  = 10 * time.Minute
+)
+
+// exposedHeaders can be read by scripts from the responses of the API
+const exposedHeaders = "ETag, Location, Retry-After, X-Request-ID"
+
+// errCORSCredentials is returned by newCORS for credentials with any origin, any site could
+// call the API with the cookies and the authorization of its visitors
+var errCORSCredentials = errors.New("cors-credentials needs a list of cors-origins instead of *")
+
+// corsPolicy decides which browser origins can call the API
+type corsPolicy struct {
+	origins     []string
+	anyOrigin   bool
+	methods     []string
+	headers     string
+	anyHeader   bool
+	credentials bool
+	maxAge      string
+}
+
+// newCORS parses the comma separated lists of the config, origins can be exact ("https://example.com"),
+// wildcard subdomains ("https://*.example.com") or "*" for any origin
+func newCORS(c Config) (*corsPolicy, error) {
+	p := &corsPolicy{
+		methods:     splitList(c.CORSMethods),
+		headers:     strings.Join(splitList(c.CORSHeaders), ", "),
+		credentials: c.CORSCredentials,
+		maxAge:      strconv.Itoa(int(c.CORSMaxAge.Seconds())),
+	}
+
+	for _, origin := range splitList(c.CORSOrigins) {
+		if origin == "*" {
+			p.anyOrigin = true
+		} else {
+			p.origins = append(p.origins, strings.ToLower(strings.TrimSuffix(origin, "/")))
+		}
+	}
+
+	for _, header := range splitList(c.CORSHeaders) {
+		p.anyHeader = p.anyHeader || header == "*"
+	}
+
+	if p.anyOrigin && p.credentials {
+		return nil, errCORSCredentials
+	}
+
+	return p, nil
+}
+
+func splitList(s string) (result []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.origins {
+		if allowed == origin {
+			return true
+		}
+
+		prefix, suffix, wildcard := strings.Cut(allowed, "*")
+		if !wildcard || len(origin) <= len(prefix)+len(suffix) ||
+			!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+			continue
+		}
+
+		// The wildcard only stands for subdomains, not for a port or a path
+		if sub := origin[len(prefix) : len(origin)-len(suffix)]; !strings.ContainsAny(sub, ":/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *corsPolicy) allowMethod(method string) bool {
+	for _, allowed := range p.methods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handle adds the CORS headers to the responses of allowed origins and answers preflight requests,
+// which don't reach the API handlers so they don't need a key and don't count against the limits
+func (p *corsPolicy) handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin == "" || !p.allowOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		// newCORS doesn't allow credentials with "*"
+		if p.anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if p.credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", exposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+
+		if !p.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+		if p.anyHeader {
+			h.Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		} else {
+			h.Set("Access-Control-Allow-Headers", p.headers)
+		}
+		h.Set("Access-Control-Max-Age", p.maxAge)
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAllowOrigin(t *testing.T) {
+	p, err := newCORS(Config{CORSOrigins: "https://app.example.com, https://*.partner.io/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin   string
+		expected bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"http://app.example.com", false},
+		{"https://evil.example.com", false},
+		{"https://a.partner.io", true},
+		{"https://a.b.partner.io", true},
+		{"https://partner.io", false},
+		{"https://.partner.io", false},
+		{"https://evilpartner.io", false},
+		{"https://a.partner.io:8443", false},
+		{"https://a.partner.io.evil.com", false},
+	}
+
+	for _, test := range tests {
+		if allowed := p.allowOrigin(test.origin); allowed != test.expected {
+			t.Errorf("allowOrigin %s error, expected %v, got %v", test.origin, test.expected, allowed)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	p, err := newCORS(Config{
+		CORSOrigins:     "https://*.example.com",
+		CORSMethods:     "GET, POST",
+		CORSHeaders:     "Content-Type, X-API-Key",
+		CORSCredentials: true,
+		CORSMaxAge:      time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	h := p.handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	request := func(method, origin, requestMethod string) *httptest.ResponseRecorder {
+		called = false
+		r := httptest.NewRequest(method, "/api/upload", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if requestMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("OPTIONS", "https://app.example.com", "POST")
+	if called || w.Code != http.StatusNoContent {
+		t.Errorf("Expected preflight to be answered with 204, got %d", w.Code)
+	}
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Content-Type, X-API-Key",
+		"Access-Control-Max-Age":           "3600",
+	}
+	for header, value := range expected {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("Preflight %s error, expected %q, got %q", header, value, got)
+		}
+	}
+
+	if w := request("OPTIONS", "https://app.example.com", "DELETE"); w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Error("Expected no allowed methods for a not allowed method")
+	}
+
+	if w := request("OPTIONS", "https://example.org", "POST"); called || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Expected no CORS headers for a not allowed origin")
+	}
+
+	w = request("POST", "https://app.example.com", "")
+	if !called || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || w.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("Expected CORS headers on the response, got %v", w.Header())
+	}
+
+	if w := request("POST", "", ""); !called || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Expected requests without Origin to pass without CORS headers")
+	}
+
+	anyOrigin, _ := newCORS(Config{CORSOrigins: "*"})
+	any := anyOrigin.handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest("POST", "/api/upload", nil)
+	r.Header.Set("Origin", "https://anywhere.com")
+	w = httptest.NewRecorder()
+	any.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected * without credentials, got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	for _, origins := range []string{"*", "https://app.example.com, *"} {
+		if _, err := newCORS(Config{CORSOrigins: origins, CORSCredentials: true}); err != errCORSCredentials {
+			t.Errorf("Expected credentials to be rejected with %q, got %v", origins, err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/simonmarton/common-colors/jobs"
+	"github.com/simonmarton/common-colors/logging"
+	"github.com/simonmarton/common-colors/pipeline"
+	"github.com/simonmarton/common-colors/processimage"
+)
+
+// Error codes of APIError
+const (
+	CodeMissingField      = "missing_field"
+	CodeInvalidJSON       = "invalid_json"
+	CodeInvalidRequest    = "invalid_request"
+	CodeBlockedURL        = "blocked_url"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeUnauthorized      = "unauthorized"
+	CodeRateLimited       = "rate_limited"
+	CodeTooLarge          = "too_large"
+	CodeUnsupportedFormat = "unsupported_format"
+	CodeInvalidImage      = "invalid_image"
+	CodeDecodeTimeout     = "decode_timeout"
+	CodeNoColors          = "no_colors"
+	CodeFetchFailed       = "fetch_failed"
+	CodeCanceled          = "canceled"
+	CodeQueueFull         = "queue_full"
+	CodeInternal          = "internal_error"
+)
+
+// APIError is returned in the body of failed requests
+type APIError struct {
+	Status int `json:"-"`
+	// Code is one of the Code constants, stable for clients to check
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Field is the form field or JSON key of the request which caused the error
+	Field string `json:"field,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// ErrorResp format
+type ErrorResp struct {
+	Error *APIError `json:"error"`
+}
+
+// fieldError is a 400 error for a form field or JSON key which is missing or can't be parsed
+func fieldError(field string, err error) *APIError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case err == http.ErrMissingFile:
+		return missingField(field)
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidJSON, Message: fmt.Sprintf("Invalid JSON in %s: %v", field, err), Field: field}
+	}
+
+	if apiErr := knownError(err); apiErr != nil {
+		apiErr.Field = field
+		return apiErr
+	}
+
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error(), Field: field}
+}
+
+func missingField(field string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeMissingField, Message: "Missing field: " + field, Field: field}
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, r, &APIError{Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed, Message: "Method not allowed"})
+}
+
+// toAPIError maps the errors of handlers to API errors, unknown errors are internal
+func toAPIError(err error) *APIError {
+	if apiErr := knownError(err); apiErr != nil {
+		return apiErr
+	}
+
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error"}
+}
+
+func knownError(err error) *APIError {
+	var apiErr *APIError
+	var maxBytesErr *http.MaxBytesError
+	var unsupported *pipeline.UnsupportedFormatError
+	var decodeErr *pipeline.DecodeError
+	var limitErr *pipeline.LimitError
+	var configErr *pipeline.ConfigError
+	var selectionErr *pipeline.SelectionError
+	var unsupportedType *processimage.UnsupportedTypeError
+	var blocked *processimage.BlockedError
+	var statusErr *processimage.StatusError
+	var fetchErr *processimage.FetchError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &maxBytesErr):
+		return &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodeTooLarge, Message: "Request body too large"}
+	case errors.As(err, &unsupported):
+		return &APIError{Status: http.StatusUnsupportedMediaType, Code: CodeUnsupportedFormat, Message: err.Error(), Field: "image"}
+	case errors.As(err, &limitErr) && limitErr.Limit == "pixels":
+		return &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodeTooLarge, Message: err.Error(), Field: "image"}
+	case errors.As(err, &limitErr):
+		return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeInvalidImage, Message: err.Error(), Field: "image"}
+	case errors.Is(err, pipeline.ErrDecodeTimeout):
+		return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeDecodeTimeout, Message: err.Error(), Field: "image"}
+	case errors.As(err, &decodeErr):
+		return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeInvalidImage, Message: err.Error(), Field: "image"}
+	case errors.As(err, &configErr):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error(), Field: "config"}
+	case errors.As(err, &selectionErr):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error(), Field: "selection"}
+	case errors.Is(err, pipeline.ErrAllFiltered):
+		return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeNoColors, Message: err.Error(), Field: "config"}
+	case errors.Is(err, processimage.ErrBodyTooLarge):
+		return &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodeTooLarge, Message: err.Error(), Field: "url"}
+	case errors.As(err, &unsupportedType):
+		return &APIError{Status: http.StatusUnsupportedMediaType, Code: CodeUnsupportedFormat, Message: err.Error(), Field: "url"}
+	case errors.As(err, &blocked):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeBlockedURL, Message: err.Error(), Field: "url"}
+	case errors.As(err, &statusErr):
+		return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeFetchFailed, Message: err.Error(), Field: "url"}
+	case errors.As(err, &fetchErr), errors.As(err, &netErr):
+		// DNS, connection, TLS errors and timeouts, *url.Error is a net.Error too
+		return &APIError{Status: http.StatusBadGateway, Code: CodeFetchFailed, Message: err.Error(), Field: "url"}
+	case errors.Is(err, jobs.ErrNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: err.Error()}
+	case errors.Is(err, jobs.ErrNoSecret):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error(), Field: "callbackUrl"}
+	case errors.Is(err, jobs.ErrQueueFull):
+		return &APIError{Status: http.StatusServiceUnavailable, Code: CodeQueueFull, Message: err.Error()}
+	}
+
+	return nil
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+	errorsTotal.Inc(apiErr.Code)
+
+	logger := logging.FromContext(r.Context())
+	if apiErr.Status == http.StatusInternalServerError {
+		logger.Error("Internal error", "error", err)
+	} else {
+		logger.Debug("Request failed", "code", apiErr.Code, "error", err)
+	}
+
+	writeJSONStatus(w, apiErr.Status, ErrorResp{Error: apiErr})
+}
+
+// recoverErrors turns panics of a handler into an internal error response instead of a dropped connection
+func recoverErrors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				writeError(w, r, fmt.Errorf("Panic: %v", v))
+			}
+		}()
+
+		next(w, r)
+	}
+}
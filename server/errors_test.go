@@ -0,0 +1,138 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/simonmarton/common-colors/pipeline"
+	"github.com/simonmarton/common-colors/processimage"
+)
+
+func TestToAPIError(t *testing.T) {
+	var errorTests = []struct {
+		err    error
+		status int
+		code   string
+		field  string
+	}{
+		{&pipeline.UnsupportedFormatError{Format: "image/gif"}, 415, CodeUnsupportedFormat, "image"},
+		{fmt.Errorf("Wrapped: %w", &pipeline.DecodeError{Err: errors.New("eof")}), 422, CodeInvalidImage, "image"},
+		{pipeline.ErrAllFiltered, 422, CodeNoColors, "config"},
+		{&http.MaxBytesError{Limit: 1}, 413, CodeTooLarge, ""},
+		{&pipeline.LimitError{Limit: "pixels", Value: 2500000000, Max: 25000000}, 413, CodeTooLarge, "image"},
+		{&pipeline.LimitError{Limit: "frames", Value: 1000, Max: 100}, 422, CodeInvalidImage, "image"},
+		{pipeline.ErrDecodeTimeout, 422, CodeDecodeTimeout, "image"},
+		{&pipeline.ConfigError{Key: "algorithm", Value: "nope"}, 400, CodeInvalidRequest, "config"},
+		{&processimage.BlockedError{Host: "localhost"}, 400, CodeBlockedURL, "url"},
+		{&processimage.StatusError{StatusCode: 404}, 422, CodeFetchFailed, "url"},
+		{&processimage.FetchError{URL: "http://a", Err: context.DeadlineExceeded}, 502, CodeFetchFailed, "url"},
+		{&url.Error{Op: "Get", URL: "http://a", Err: &net.DNSError{Err: "no such host", Name: "a", IsNotFound: true}}, 502, CodeFetchFailed, "url"},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, 502, CodeFetchFailed, "url"},
+		{&url.Error{Op: "Get", URL: "https://a", Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}}, 502, CodeFetchFailed, "url"},
+		{&url.Error{Op: "Get", URL: "http://a", Err: &processimage.BlockedError{Host: "a"}}, 400, CodeBlockedURL, "url"},
+		{errors.New("Something else"), 500, CodeInternal, ""},
+	}
+
+	for _, tt := range errorTests {
+		e := toAPIError(tt.err)
+		if e.Status != tt.status || e.Code != tt.code || e.Field != tt.field {
+			t.Errorf("toAPIError error for %v, expected %d %s %s, got %+v", tt.err, tt.status, tt.code, tt.field, e)
+		}
+	}
+}
+
+func TestUploadErrors(t *testing.T) {
+	var uploadTests = []struct {
+		fields map[string]string
+		image  bool
+		status int
+		code   string
+		field  string
+	}{
+		{map[string]string{"config": "{}"}, false, 400, CodeMissingField, "image"},
+		{map[string]string{}, true, 400, CodeMissingField, "config"},
+		{map[string]string{"config": "{"}, true, 400, CodeInvalidJSON, "config"},
+		{map[string]string{"config": "{}", "selection": `{"rect": 1}`}, true, 400, CodeInvalidJSON, "selection"},
+		{map[string]string{"config": `{"algorithm": "nope"}`}, true, 400, CodeInvalidRequest, "config"},
+		{map[string]string{"config": `{"sampling": "all"}`}, true, 400, CodeInvalidRequest, "config"},
+		{map[string]string{"config": `{"background": "red"}`}, true, 400, CodeInvalidRequest, "config"},
+		{map[string]string{"config": "{}", "selection": `{"rect": {"x": 5, "y": 5, "width": -3, "height": 2}}`}, true, 400, CodeInvalidRequest, "selection"},
+		{map[string]string{"config": "{}", "selection": `{"polygons": [` + strings.Repeat(`[{"x":0,"y":0}],`, pipeline.MaxPolygons) + `[]]}`}, true, 400, CodeInvalidRequest, "selection"},
+	}
+
+	for _, tt := range uploadTests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if tt.image {
+			fw, _ := mw.CreateFormFile("image", "a.png")
+			fw.Write([]byte("a"))
+		}
+		for k, v := range tt.fields {
+			mw.WriteField(k, v)
+		}
+		mw.Close()
+
+		r := httptest.NewRequest("POST", "/api/upload", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		recoverErrors(handleUpload(&fakeHandler{}, nil, pipeline.Limits{}, false))(w, r)
+
+		var resp ErrorResp
+		json.Unmarshal(w.Body.Bytes(), &resp)
+
+		if w.Code != tt.status || resp.Error == nil || resp.Error.Code != tt.code || resp.Error.Field != tt.field {
+			t.Errorf("Upload error for %v, expected %d %s %s, got %d %s", tt.fields, tt.status, tt.code, tt.field, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRecoverErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	recoverErrors(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != 500 || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON internal error, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUploadMaskLimit(t *testing.T) {
+	var mask bytes.Buffer
+	png.Encode(&mask, image.NewGray(image.Rect(0, 0, 10, 10)))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("image", "a.png")
+	fw.Write([]byte("a"))
+	fw, _ = mw.CreateFormFile("mask", "mask.png")
+	fw.Write(mask.Bytes())
+	mw.WriteField("config", "{}")
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/api/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	handleUpload(&fakeHandler{}, nil, pipeline.Limits{MaxPixels: 50}, false)(w, r)
+
+	var resp ErrorResp
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if w.Code != 413 || resp.Error == nil || resp.Error.Field != "mask" {
+		t.Errorf("Expected 413 for a mask over the pixel limit, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"github.com/simonmarton/common-colors/cache"
+	"github.com/simonmarton/common-colors/processimage"
+)
+
+// FetchingHandler is an APIHandler which downloads URLs with a processimage.Fetcher,
+// New gives it the fetcher with the host restrictions and timeout of the Config
+type FetchingHandler interface {
+	APIHandler
+	WithFetcher(f *processimage.Fetcher) APIHandler
+}
+
+// newFetcher creates the fetcher of image and callback URLs from the config,
+// downloaded images and their results are kept in the result cache of the server
+func newFetcher(c Config, resultCache cache.Cache) *processimage.Fetcher {
+	return processimage.NewFetcher(processimage.FetcherConfig{
+		ReadTimeout:          c.FetchTimeout,
+		AllowPrivateNetworks: c.AllowPrivateNetworks,
+		AllowedHosts:         splitList(c.AllowedHosts),
+		DeniedHosts:          splitList(c.DeniedHosts),
+		Cache:                resultCache,
+	})
+}
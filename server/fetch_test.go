@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/simonmarton/common-colors/logging"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+	"github.com/simonmarton/common-colors/processimage"
+)
+
+// fetchingHandler processes URLs with the fetcher of the server like the handler of main
+type fetchingHandler struct {
+	fakeHandler
+	fetcher *processimage.Fetcher
+}
+
+func (h *fetchingHandler) WithFetcher(f *processimage.Fetcher) APIHandler {
+	h.fetcher = f
+	return h
+}
+
+func (h *fetchingHandler) ProcessURL(ctx context.Context, url string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error) {
+	return h.fetcher.FromURLWithConfig(ctx, url, config, opts)
+}
+
+func postURL(t *testing.T, s *Server, url string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(URLReq{URL: url})
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/url", strings.NewReader(string(body))))
+
+	return w
+}
+
+func TestFetcherConfig(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("../test-images")))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		config Config
+		code   string
+	}{
+		{"private network", Config{}, CodeBlockedURL},
+		{"allowed", Config{AllowPrivateNetworks: true, AllowedHosts: "127.0.0.1, example.com"}, ""},
+		{"not allowed", Config{AllowPrivateNetworks: true, AllowedHosts: "example.com"}, CodeBlockedURL},
+		{"denied", Config{AllowPrivateNetworks: true, DeniedHosts: "127.0.0.1"}, CodeBlockedURL},
+	}
+
+	for _, test := range tests {
+		test.config.Logger = logging.Discard
+		test.config.DisableStatic = true
+		test.config.JobsDir = t.TempDir()
+
+		h := &fetchingHandler{}
+		s, err := New(h, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h.fetcher == nil {
+			t.Fatalf("Expected the handler to get the fetcher of the server")
+		}
+
+		w := postURL(t, s, ts.URL+"/test-colors.png")
+
+		var resp ErrorResp
+		json.Unmarshal(w.Body.Bytes(), &resp)
+
+		code := ""
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+
+		if code != test.code {
+			t.Errorf("%s: expected %q error, got %d %s", test.name, test.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestFetcherCache(t *testing.T) {
+	var requests int32
+	images := http.FileServer(http.Dir("../test-images"))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		images.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	s, err := New(&fetchingHandler{}, Config{Logger: logging.Discard, DisableStatic: true, JobsDir: t.TempDir(), AllowPrivateNetworks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := postURL(t, s, ts.URL+"/test-colors.png")
+	second := postURL(t, s, ts.URL+"/test-colors.png")
+
+	if first.Code != 200 || second.Body.String() != first.Body.String() {
+		t.Fatalf("Expected the same result twice, got %d %s and %s", first.Code, first.Body.String(), second.Body.String())
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected the image to be downloaded once, got %d requests", n)
+	}
+}
+
+func TestFetchFailed(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	s, err := New(&fetchingHandler{}, Config{Logger: logging.Discard, DisableStatic: true, JobsDir: t.TempDir(), AllowPrivateNetworks: true, FetchTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range []string{closed.URL + "/a.png", slow.URL + "/a.png"} {
+		w := postURL(t, s, u)
+
+		var resp ErrorResp
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != 502 || resp.Error == nil || resp.Error.Code != CodeFetchFailed || resp.Error.Field != "url" {
+			t.Errorf("Expected a fetch error for %s, got %d %s", u, w.Code, w.Body.String())
+		}
+	}
+}
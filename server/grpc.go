@@ -0,0 +1,472 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/simonmarton/common-colors/colorspb"
+	"github.com/simonmarton/common-colors/logging"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+// grpcService serves the extraction over gRPC with the same handler as the HTTP API
+type grpcService struct {
+	colorspb.UnimplementedCommonColorsServer
+
+	h             APIHandler
+	limits        pipeline.Limits
+	workers       int
+	maxUploadSize int64
+}
+
+// newGRPC creates the gRPC server of the config, the same keys and limits apply as for the HTTP API,
+// but requests can only be authenticated with a key, not signed
+func newGRPC(h APIHandler, c Config, limits pipeline.Limits, keys *apiKeys, rate *rateLimiter, concurrency *concurrencyLimiter) (*grpc.Server, error) {
+	g := &grpcGuard{logger: c.Logger, keys: keys, rate: rate, concurrency: concurrency, trustProxy: c.TrustProxy}
+
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(int(c.MaxUploadSize)),
+		// Recovery runs inside the guard, so panics are logged and counted as Internal
+		grpc.ChainUnaryInterceptor(g.unary, recoverUnary),
+		grpc.ChainStreamInterceptor(g.stream, recoverStream),
+	}
+
+	if c.TLSCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	s := grpc.NewServer(opts...)
+	colorspb.RegisterCommonColorsServer(s, &grpcService{h: h, limits: limits, workers: c.BatchWorkers, maxUploadSize: c.MaxUploadSize})
+
+	return s, nil
+}
+
+// Extract ...
+func (s *grpcService) Extract(ctx context.Context, req *colorspb.ExtractRequest) (*colorspb.ExtractResponse, error) {
+	selection, err := selectionFromPB(req.GetSelection(), s.limits)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	config, err := configFromPB(req.GetConfig())
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	opts := pipeline.Options{Selection: selection, WithSteps: req.GetWithSteps(), Logger: logging.FromContext(ctx)}
+
+	var result CommonColorsResp
+	switch source := req.GetImage().GetSource().(type) {
+	case *colorspb.Image_Data:
+		result, err = s.h.ProcessImage(bytes.NewReader(source.Data), req.GetImage().GetType(), config, opts)
+	case *colorspb.Image_Url:
+		result, err = s.h.ProcessURL(ctx, source.Url, config, opts)
+	default:
+		err = missingField("image")
+	}
+
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return resultToPB(result), nil
+}
+
+// Upload ...
+func (s *grpcService) Upload(stream colorspb.CommonColors_UploadServer) error {
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	header := first.GetHeader()
+	if header == nil {
+		return grpcError(ctx, missingField("header"))
+	}
+
+	config, err := configFromPB(header.GetConfig())
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+
+	var data bytes.Buffer
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if int64(data.Len()+len(req.GetChunk())) > s.maxUploadSize {
+			return grpcError(ctx, &http.MaxBytesError{Limit: s.maxUploadSize})
+		}
+		data.Write(req.GetChunk())
+	}
+
+	selection, err := selectionFromPB(header.GetSelection(), s.limits)
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+
+	opts := pipeline.Options{Selection: selection, WithSteps: header.GetWithSteps(), Logger: logging.FromContext(ctx)}
+	result, err := s.h.ProcessImage(&data, header.GetType(), config, opts)
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+
+	return stream.SendAndClose(resultToPB(result))
+}
+
+// Batch ...
+func (s *grpcService) Batch(req *colorspb.BatchRequest, stream colorspb.CommonColors_BatchServer) error {
+	ctx := stream.Context()
+
+	config, err := configFromPB(req.GetConfig())
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+
+	// The mask is skipped like in HTTP batches
+	selection, err := selectionFromPB(&colorspb.Selection{Rect: req.GetSelection().GetRect(), Polygons: req.GetSelection().GetPolygons()}, s.limits)
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+
+	var inputs []batchInput
+	for _, img := range req.GetImages() {
+		in := batchInput{name: img.GetName(), imageType: img.GetType()}
+		switch source := img.GetSource().(type) {
+		case *colorspb.Image_Data:
+			in.data = source.Data
+		case *colorspb.Image_Url:
+			in.url = source.Url
+			if in.name == "" {
+				in.name = source.Url
+			}
+		default:
+			return grpcError(ctx, missingField("images"))
+		}
+		inputs = append(inputs, in)
+	}
+
+	opts := pipeline.Options{Selection: selection, Logger: logging.FromContext(ctx)}
+
+	var sendErr error
+	processBatch(ctx, s.h, inputs, config, opts, s.workers, func(item BatchItem) {
+		if sendErr == nil {
+			sendErr = stream.Send(batchItemToPB(item))
+		}
+	})
+
+	if sendErr != nil {
+		return sendErr
+	}
+
+	return ctx.Err()
+}
+
+// configFromPB converts and checks the config of a request
+func configFromPB(c *colorspb.Config) (models.CalculatorConfig, error) {
+	config := models.CalculatorConfig{
+		TransparencyTreshold: uint8(min(c.GetTransparencyTreshold(), 255)),
+		IterationCount:       int8(max(min(c.GetIterationCount(), 127), -128)),
+		MinLuminance:         c.GetMinLuminance(),
+		MaxLuminance:         c.GetMaxLuminance(),
+		DistanceThreshold:    c.GetDistanceThreshold(),
+		MinSaturation:        c.GetMinSaturation(),
+		Algorithm:            c.GetAlgorithm(),
+		AlphaWeighted:        c.GetAlphaWeighted(),
+		Background:           c.GetBackground(),
+		Sampling:             c.GetSampling(),
+		PixelBudget:          int(c.GetPixelBudget()),
+		ResizeFilter:         c.GetResizeFilter(),
+		Seed:                 c.GetSeed(),
+		BackgroundRemoval:    c.GetBackgroundRemoval(),
+		BackgroundTolerance:  c.GetBackgroundTolerance(),
+		BackgroundWeight:     c.GetBackgroundWeight(),
+		SpatialWeighting:     c.GetSpatialWeighting(),
+		CenterSigma:          c.GetCenterSigma(),
+	}
+
+	return config, checkConfig(config)
+}
+
+// selectionFromPB converts the selection and decodes its mask within the limits
+func selectionFromPB(s *colorspb.Selection, limits pipeline.Limits) (selection models.Selection, err error) {
+	if r := s.GetRect(); r != nil {
+		selection.Rect = &models.Rect{X: int(r.GetX()), Y: int(r.GetY()), Width: int(r.GetWidth()), Height: int(r.GetHeight())}
+	}
+
+	for _, polygon := range s.GetPolygons() {
+		var points []models.Point
+		for _, p := range polygon.GetPoints() {
+			points = append(points, models.Point{X: p.GetX(), Y: p.GetY()})
+		}
+		selection.Polygons = append(selection.Polygons, points)
+	}
+
+	if err := checkSelection(selection); err != nil {
+		return selection, err
+	}
+
+	if mask := s.GetMask(); len(mask) > 0 {
+		if err := limits.Check(mask); err != nil {
+			return selection, fieldError("mask", err)
+		}
+
+		selection.Mask, _, err = image.Decode(bytes.NewReader(mask))
+		if err != nil {
+			return selection, fieldError("mask", &pipeline.DecodeError{Err: err})
+		}
+	}
+
+	return selection, nil
+}
+
+func resultToPB(r CommonColorsResp) *colorspb.ExtractResponse {
+	resp := &colorspb.ExtractResponse{Gradient: r.Gradient}
+
+	for _, c := range r.Colors {
+		resp.Colors = append(resp.Colors, &colorspb.Color{Value: c.Value, Weight: c.Weight, HueDistance: c.HueDistance})
+	}
+
+	for _, step := range r.StepsOfColors {
+		s := &colorspb.Step{}
+		for _, c := range step {
+			s.Colors = append(s.Colors, &colorspb.StepColor{R: uint32(c.R), G: uint32(c.G), B: uint32(c.B), Weight: c.Weight})
+		}
+		resp.Steps = append(resp.Steps, s)
+	}
+
+	return resp
+}
+
+func batchItemToPB(item BatchItem) *colorspb.BatchItem {
+	resp := &colorspb.BatchItem{Index: int32(item.Index), Name: item.Name}
+
+	if item.Error != nil {
+		resp.Outcome = &colorspb.BatchItem_Error{Error: &colorspb.Error{Code: item.Error.Code, Message: item.Error.Message, Field: item.Error.Field}}
+	} else if item.Result != nil {
+		resp.Outcome = &colorspb.BatchItem_Result{Result: resultToPB(*item.Result)}
+	}
+
+	return resp
+}
+
+// grpcCodes map the status codes of API errors to gRPC codes
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusMethodNotAllowed:      codes.Unimplemented,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusUnsupportedMediaType:  codes.InvalidArgument,
+	http.StatusUnprocessableEntity:   codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusBadGateway:            codes.Unavailable,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+}
+
+// grpcError maps an error to a gRPC status with the code and field of the API error in an ErrorInfo detail
+func grpcError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		return status.FromContextError(ctxErr).Err()
+	}
+
+	apiErr := toAPIError(err)
+	errorsTotal.Inc(apiErr.Code)
+
+	logger := logging.FromContext(ctx)
+	if apiErr.Status == http.StatusInternalServerError {
+		logger.Error("Internal error", "error", err)
+	} else {
+		logger.Debug("Request failed", "code", apiErr.Code, "error", err)
+	}
+
+	code, ok := grpcCodes[apiErr.Status]
+	if !ok {
+		code = codes.Internal
+	}
+
+	info := &errdetails.ErrorInfo{Reason: apiErr.Code, Domain: "common-colors"}
+	if apiErr.Field != "" {
+		info.Metadata = map[string]string{"field": apiErr.Field}
+	}
+
+	st, detailsErr := status.New(code, apiErr.Message).WithDetails(info)
+	if detailsErr != nil {
+		return status.Error(code, apiErr.Message)
+	}
+
+	return st.Err()
+}
+
+// grpcGuard is the gRPC counterpart of the HTTP middlewares: request IDs, logging, metrics, keys and limits
+type grpcGuard struct {
+	logger      *slog.Logger
+	keys        *apiKeys
+	rate        *rateLimiter
+	concurrency *concurrencyLimiter
+	trustProxy  bool
+}
+
+func (g *grpcGuard) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var resp interface{}
+	err := g.guard(ctx, info.FullMethod, func(ctx context.Context) (err error) {
+		resp, err = handler(ctx, req)
+		return err
+	})
+
+	return resp, err
+}
+
+func (g *grpcGuard) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return g.guard(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+		return handler(srv, &guardedStream{ServerStream: ss, ctx: ctx})
+	})
+}
+
+// guard runs a call with the request ID and logger in its context after checking the key and the limits
+func (g *grpcGuard) guard(ctx context.Context, method string, call func(context.Context) error) error {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	id := first(md, "x-request-id")
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	ctx = logging.WithRequestID(logging.NewContext(ctx, g.logger), id)
+
+	err := g.check(ctx, md, call)
+
+	code := status.Code(err)
+	requestsTotal.Inc(method, "grpc", code.String())
+	requestDuration.Observe(time.Since(start).Seconds(), method)
+	logging.FromContext(ctx).Info("Request", "method", "grpc", "path", method, "code", code.String(), "duration", time.Since(start))
+
+	return err
+}
+
+func (g *grpcGuard) check(ctx context.Context, md metadata.MD, call func(context.Context) error) error {
+	if g.keys != nil {
+		// Rate limited per IP before the key is checked, like the HTTP API
+		if _, retryAfter, err := acquireLimits(g.rate, nil, clientID(ctx, g.clientIP(ctx, md))); err != nil {
+			grpc.SetTrailer(ctx, metadata.Pairs("retry-after", retryAfterSeconds(retryAfter)))
+			return grpcError(ctx, err)
+		}
+
+		key := first(md, "x-api-key")
+		if bearer, ok := strings.CutPrefix(first(md, "authorization"), "Bearer "); ok && key == "" {
+			key = strings.TrimSpace(bearer)
+		}
+
+		id, err := g.keys.lookup(key)
+		if err != nil {
+			return grpcError(ctx, err)
+		}
+
+		ctx = withClient(logging.NewContext(ctx, logging.FromContext(ctx).With("client", id)), id)
+	}
+
+	release, retryAfter, err := acquireLimits(g.rate, g.concurrency, clientID(ctx, g.clientIP(ctx, md)))
+	if err != nil {
+		grpc.SetTrailer(ctx, metadata.Pairs("retry-after", retryAfterSeconds(retryAfter)))
+		return grpcError(ctx, err)
+	}
+	defer release()
+
+	return call(ctx)
+}
+
+// recoverUnary turns the panic of a call into an internal error instead of crashing the server
+func recoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			resp, err = nil, grpcPanic(ctx, v)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// recoverStream is recoverUnary for streams
+func recoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = grpcPanic(ss.Context(), v)
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+func grpcPanic(ctx context.Context, v interface{}) error {
+	logging.FromContext(ctx).Error("Call panicked", "panic", v, "stack", string(debug.Stack()))
+	return grpcError(ctx, fmt.Errorf("Panic: %v", v))
+}
+
+// clientIP is the peer address of the call, or the last X-Forwarded-For address when the proxy is trusted
+func (g *grpcGuard) clientIP(ctx context.Context, md metadata.MD) string {
+	if forwarded := md.Get("x-forwarded-for"); g.trustProxy && len(forwarded) > 0 {
+		addrs := strings.Split(forwarded[len(forwarded)-1], ",")
+		return strings.TrimSpace(addrs[len(addrs)-1])
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// guardedStream replaces the context of a stream with the one carrying the request ID and the client
+type guardedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *guardedStream) Context() context.Context {
+	return s.ctx
+}
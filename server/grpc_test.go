@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/simonmarton/common-colors/colorspb"
+	"github.com/simonmarton/common-colors/logging"
+)
+
+func grpcClient(t *testing.T, c Config) colorspb.CommonColorsClient {
+	c.Logger = logging.Discard
+	c.DisableStatic = true
+	c.JobsDir = t.TempDir()
+	c.GRPCAddr = "bufconn"
+
+	s, err := New(&fakeHandler{}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln := bufconn.Listen(1 << 20)
+	go s.grpc.Serve(ln)
+	t.Cleanup(s.grpc.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return colorspb.NewCommonColorsClient(conn)
+}
+
+// errorReason is the API error code in the details of a gRPC error
+func errorReason(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+
+	return ""
+}
+
+func TestGRPCExtract(t *testing.T) {
+	client := grpcClient(t, Config{})
+	ctx := context.Background()
+
+	var header metadata.MD
+	resp, err := client.Extract(ctx, &colorspb.ExtractRequest{Image: &colorspb.Image{Source: &colorspb.Image_Data{Data: []byte("abc")}, Type: "image/png"}}, grpc.Header(&header))
+	if err != nil || strings.Join(resp.GetGradient(), ",") != "abc" {
+		t.Errorf("Expected the result of the image, got %v %v", resp, err)
+	}
+
+	if len(header.Get("x-request-id")) != 1 {
+		t.Errorf("Expected a request ID in the header, got %v", header)
+	}
+
+	resp, err = client.Extract(ctx, &colorspb.ExtractRequest{Image: &colorspb.Image{Source: &colorspb.Image_Url{Url: "http://a"}}})
+	if err != nil || strings.Join(resp.GetGradient(), ",") != "http://a" {
+		t.Errorf("Expected the result of the URL, got %v %v", resp, err)
+	}
+
+	var errorTests = []struct {
+		req    *colorspb.ExtractRequest
+		code   codes.Code
+		reason string
+	}{
+		{&colorspb.ExtractRequest{Image: &colorspb.Image{Source: &colorspb.Image_Data{Data: []byte("broken")}}}, codes.InvalidArgument, CodeInvalidImage},
+		{&colorspb.ExtractRequest{}, codes.InvalidArgument, CodeMissingField},
+		{&colorspb.ExtractRequest{
+			Image:     &colorspb.Image{Source: &colorspb.Image_Url{Url: "http://a"}},
+			Selection: &colorspb.Selection{Mask: []byte("not an image")},
+		}, codes.InvalidArgument, CodeInvalidImage},
+		{&colorspb.ExtractRequest{Image: &colorspb.Image{Source: &colorspb.Image_Data{Data: []byte("panic")}}}, codes.Internal, CodeInternal},
+	}
+
+	for _, tt := range errorTests {
+		_, err := client.Extract(ctx, tt.req)
+		if status.Code(err) != tt.code || errorReason(err) != tt.reason {
+			t.Errorf("Extract error for %v, expected %s %s, got %v %s", tt.req, tt.code, tt.reason, err, errorReason(err))
+		}
+	}
+}
+
+func TestGRPCUpload(t *testing.T) {
+	client := grpcClient(t, Config{MaxUploadSize: 64})
+
+	upload := func(chunks ...string) (*colorspb.ExtractResponse, error) {
+		stream, err := client.Upload(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		stream.Send(&colorspb.UploadRequest{Part: &colorspb.UploadRequest_Header{Header: &colorspb.UploadHeader{Type: "image/png"}}})
+		for _, chunk := range chunks {
+			if err := stream.Send(&colorspb.UploadRequest{Part: &colorspb.UploadRequest_Chunk{Chunk: []byte(chunk)}}); err != nil {
+				break
+			}
+		}
+
+		return stream.CloseAndRecv()
+	}
+
+	resp, err := upload("ab", "cd")
+	if err != nil || strings.Join(resp.GetGradient(), ",") != "abcd" {
+		t.Errorf("Expected the result of the joined chunks, got %v %v", resp, err)
+	}
+
+	chunk := strings.Repeat("a", 40)
+	if _, err := upload(chunk, chunk); status.Code(err) != codes.ResourceExhausted || errorReason(err) != CodeTooLarge {
+		t.Errorf("Expected ResourceExhausted over the upload size, got %v", err)
+	}
+
+	if _, err := upload("panic"); status.Code(err) != codes.Internal || errorReason(err) != CodeInternal {
+		t.Errorf("Expected Internal for a panic, got %v", err)
+	}
+}
+
+func TestGRPCBatch(t *testing.T) {
+	client := grpcClient(t, Config{BatchWorkers: 2})
+
+	stream, err := client.Batch(context.Background(), &colorspb.BatchRequest{Images: []*colorspb.Image{
+		{Source: &colorspb.Image_Data{Data: []byte("a")}, Name: "a.png"},
+		{Source: &colorspb.Image_Data{Data: []byte("broken")}, Name: "broken.png"},
+		{Source: &colorspb.Image_Url{Url: "http://c"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []string
+	for {
+		item, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if item.GetError() != nil {
+			items = append(items, item.GetName()+":"+item.GetError().GetCode())
+		} else {
+			items = append(items, item.GetName()+":"+strings.Join(item.GetResult().GetGradient(), ","))
+		}
+	}
+	sort.Strings(items)
+
+	expected := "a.png:a,broken.png:invalid_image,http://c:http://c"
+	if strings.Join(items, ",") != expected {
+		t.Errorf("Expected %s, got %v", expected, items)
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(path, []byte("partner secret\n"), 0600)
+
+	// The failed call counts against the IP too
+	client := grpcClient(t, Config{APIKeysFile: path, RateLimit: 60, RateBurst: 2})
+	req := &colorspb.ExtractRequest{Image: &colorspb.Image{Source: &colorspb.Image_Url{Url: "http://a"}}}
+
+	if _, err := client.Extract(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a key, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if _, err := client.Extract(ctx, req); err != nil {
+		t.Errorf("Expected the key to be accepted, got %v", err)
+	}
+
+	var trailer metadata.MD
+	if _, err := client.Extract(ctx, req, grpc.Trailer(&trailer)); status.Code(err) != codes.ResourceExhausted || len(trailer.Get("retry-after")) != 1 {
+		t.Errorf("Expected ResourceExhausted with retry-after over the rate limit, got %v %v", err, trailer)
+	}
+}
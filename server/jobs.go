@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/simonmarton/common-colors/jobs"
+	"github.com/simonmarton/common-colors/logging"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+// JobReq format of JSON job requests
+type JobReq struct {
+	URL         string                  `json:"url"`
+	Config      models.CalculatorConfig `json:"config"`
+	Selection   models.Selection        `json:"selection"`
+	CallbackURL string                  `json:"callbackUrl"`
+}
+
+// jobProcessor runs the jobs with the handler and reports the clustering steps as progress
+func jobProcessor(h APIHandler, logger *slog.Logger) jobs.Processor {
+	return func(ctx context.Context, job jobs.Job, progress func(float64)) (CommonColorsResp, error) {
+		// Sampled, filtered and every iteration
+		total := float64(pipeline.Normalize(job.Input.Config).IterationCount) + 2
+		steps := 0
+
+		opts := pipeline.Options{
+			Selection: job.Input.Selection,
+			Logger:    logging.Or(logger).With("job_id", job.ID),
+			OnStep: func([]ColorStepResp) {
+				steps++
+				progress(min(float64(steps)/total, 1))
+			},
+		}
+
+		if job.Input.URL != "" {
+			return h.ProcessURL(ctx, job.Input.URL, job.Input.Config, opts)
+		}
+
+		// Not cancelable once started, the result is dropped
+		return h.ProcessImage(bytes.NewReader(job.Input.Image), job.Input.ImageType, job.Input.Config, opts)
+	}
+}
+
+// parseJob reads a multipart form like /api/upload with a callbackUrl value or a JSON JobReq
+func parseJob(r *http.Request) (in jobs.Input, callbackURL string, err error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		var req JobReq
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return in, "", fieldError("body", err)
+		}
+
+		if req.URL == "" {
+			return in, "", missingField("url")
+		}
+
+		if err = checkConfig(req.Config); err != nil {
+			return in, "", err
+		}
+
+		return jobs.Input{URL: req.URL, Config: req.Config, Selection: req.Selection}, req.CallbackURL, checkSelection(req.Selection)
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		return in, "", fieldError("image", err)
+	}
+	defer file.Close()
+
+	if in.Image, err = io.ReadAll(file); err != nil {
+		return in, "", fieldError("image", err)
+	}
+	in.ImageType = header.Header.Get("Content-Type")
+
+	if v := r.FormValue("config"); v != "" {
+		if err = json.Unmarshal([]byte(v), &in.Config); err != nil {
+			return in, "", fieldError("config", err)
+		}
+
+		if err = checkConfig(in.Config); err != nil {
+			return in, "", err
+		}
+	}
+
+	// Masks are not supported, they can't be persisted with the job
+	if v := r.FormValue("selection"); v != "" {
+		if err = json.Unmarshal([]byte(v), &in.Selection); err != nil {
+			return in, "", fieldError("selection", err)
+		}
+
+		if err = checkSelection(in.Selection); err != nil {
+			return in, "", err
+		}
+	}
+
+	return in, r.FormValue("callbackUrl"), nil
+}
+
+// handleJobs queues jobs, they can be fetched at jobPath followed by their ID
+func handleJobs(q *jobs.Queue, jobPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+
+		in, callbackURL, err := parseJob(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		job, err := q.Submit(in, callbackURL)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", jobPath+job.ID)
+		writeJSONStatus(w, http.StatusAccepted, job)
+	}
+}
+
+func handleJob(q *jobs.Queue, jobPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, jobPath)
+
+		var job jobs.Job
+		var err error
+
+		switch r.Method {
+		case http.MethodGet:
+			job, err = q.Get(id)
+		case http.MethodDelete:
+			job, err = q.Cancel(id)
+		default:
+			methodNotAllowed(w, r, "GET, DELETE")
+			return
+		}
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, job)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonmarton/common-colors/jobs"
+)
+
+func TestJobs(t *testing.T) {
+	q, err := jobs.New(jobs.Config{Store: jobs.NewMemoryStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, jobProcessor(&fakeHandler{}, nil))
+
+	r := httptest.NewRequest("POST", "/api/jobs", bytes.NewBufferString(`{"url": "http://a"}`))
+	w := httptest.NewRecorder()
+	handleJobs(q, "/api/jobs/")(w, r)
+
+	if w.Code != 202 {
+		t.Fatalf("Expected 202, got %d", w.Code)
+	}
+
+	var job jobs.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if w.Header().Get("Location") != "/api/jobs/"+job.ID {
+		t.Errorf("Expected location of the job, got %s", w.Header().Get("Location"))
+	}
+
+	for i := 0; i < 200 && job.Status != jobs.Done; i++ {
+		time.Sleep(5 * time.Millisecond)
+
+		w = httptest.NewRecorder()
+		handleJob(q, "/api/jobs/")(w, httptest.NewRequest("GET", "/api/jobs/"+job.ID, nil))
+		json.Unmarshal(w.Body.Bytes(), &job)
+	}
+
+	if job.Status != jobs.Done || job.Result.Gradient[0] != "http://a" {
+		t.Errorf("Expected finished job, got %+v", job)
+	}
+
+	w = httptest.NewRecorder()
+	handleJob(q, "/api/jobs/")(w, httptest.NewRequest("GET", "/api/jobs/unknown", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected 404 for unknown job, got %d", w.Code)
+	}
+
+	// Callbacks are only sent signed
+	w = httptest.NewRecorder()
+	handleJobs(q, "/api/jobs/")(w, httptest.NewRequest("POST", "/api/jobs", bytes.NewBufferString(`{"url": "http://a", "callbackUrl": "http://b"}`)))
+	if w.Code != 400 || !strings.Contains(w.Body.String(), `"field":"callbackUrl"`) {
+		t.Errorf("Expected 400 for a callback without a webhook secret, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often the buckets of idle clients are dropped
+const pruneInterval = time.Minute
+
+type clientKey struct{}
+
+// withClient stores the API key ID of an authenticated request
+func withClient(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientKey{}, id)
+}
+
+// clientID is the API key ID of the request, or its IP without authentication
+func clientID(ctx context.Context, ip string) string {
+	if id, ok := ctx.Value(clientKey{}).(string); ok {
+		return "key:" + id
+	}
+
+	return "ip:" + ip
+}
+
+// clientIP is the remote address of the request, or the address added to
+// X-Forwarded-For by the proxy in front of the server when it's trusted
+func clientIP(r *http.Request, trustProxy bool) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); trustProxy && forwarded != "" {
+		addrs := strings.Split(forwarded, ",")
+		return strings.TrimSpace(addrs[len(addrs)-1])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// rateLimiter is a token bucket per client, refilled with rate tokens per second up to burst
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+
+	return &rateLimiter{rate: float64(perMinute) / 60, burst: float64(burst), buckets: map[string]*bucket{}}
+}
+
+// allow takes a token of the client, or returns how long it has to wait for one
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) > pruneInterval {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// prune drops the buckets which are full again, they are the same as new ones
+func (l *rateLimiter) prune(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastPrune = now
+}
+
+// concurrencyLimiter limits the requests in progress per client
+type concurrencyLimiter struct {
+	max int
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+	return &concurrencyLimiter{max: max, active: map[string]int{}}
+}
+
+func (l *concurrencyLimiter) acquire(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[client] >= l.max {
+		return false
+	}
+
+	l.active[client]++
+	return true
+}
+
+func (l *concurrencyLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[client]--; l.active[client] <= 0 {
+		delete(l.active, client)
+	}
+}
+
+// acquireLimits takes a token and a concurrency slot of the client, either of the limiters can be nil.
+// release has to be called when the request is done, retryAfter is set when the client is over a limit.
+func acquireLimits(rate *rateLimiter, concurrency *concurrencyLimiter, client string) (release func(), retryAfter time.Duration, err error) {
+	if rate != nil {
+		if ok, wait := rate.allow(client, time.Now()); !ok {
+			return nil, wait, tooManyRequests("Rate limit exceeded")
+		}
+	}
+
+	if concurrency != nil {
+		if !concurrency.acquire(client) {
+			return nil, time.Second, tooManyRequests("Too many concurrent requests")
+		}
+		return func() { concurrency.release(client) }, 0, nil
+	}
+
+	return func() {}, 0, nil
+}
+
+// limitRequests answers 429 with Retry-After when a client is over the rate or concurrency limit
+func limitRequests(rate *rateLimiter, concurrency *concurrencyLimiter, trustProxy bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, retryAfter, err := acquireLimits(rate, concurrency, clientID(r.Context(), clientIP(r, trustProxy)))
+		if err != nil {
+			w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+			writeError(w, r, err)
+			return
+		}
+		defer release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(message string) *APIError {
+	return &APIError{Status: http.StatusTooManyRequests, Code: CodeRateLimited, Message: message}
+}
+
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
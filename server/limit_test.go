@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(60, 2)
+	now := time.Unix(1700000000, 0)
+
+	for i, expected := range []bool{true, true, false} {
+		if ok, _ := l.allow("ip:10.0.0.1", now); ok != expected {
+			t.Errorf("allow %d error, expected %v, got %v", i, expected, ok)
+		}
+	}
+
+	if _, wait := l.allow("ip:10.0.0.1", now); wait != time.Second {
+		t.Errorf("Expected to wait a second, got %v", wait)
+	}
+
+	if ok, _ := l.allow("ip:10.0.0.2", now); !ok {
+		t.Error("Expected a separate bucket per client")
+	}
+
+	if ok, _ := l.allow("ip:10.0.0.1", now.Add(time.Second)); !ok {
+		t.Error("Expected a token after a second")
+	}
+
+	l.allow("ip:10.0.0.3", now.Add(time.Hour))
+	if len(l.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be pruned, got %d", len(l.buckets))
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := limitRequests(newRateLimiter(60, 3), newConcurrencyLimiter(1), true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+	}))
+
+	request := func(path, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, nil)
+		r.Header.Set("X-Forwarded-For", "203.0.113.9, "+ip)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	done := make(chan struct{})
+	go func() {
+		request("/slow", "10.0.0.1")
+		close(done)
+	}()
+	<-started
+
+	if w := request("/fast", "10.0.0.1"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 429 with Retry-After over the concurrency limit, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if w := request("/fast", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("Expected another IP to pass, got %d", w.Code)
+	}
+
+	close(release)
+	<-done
+
+	if w := request("/fast", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Errorf("Expected the third request to pass, got %d", w.Code)
+	}
+
+	if w := request("/fast", "10.0.0.1"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After over the rate limit, got %d", w.Code)
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/simonmarton/common-colors/metrics"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+var (
+	registry = metrics.NewRegistry()
+
+	requestsTotal = registry.Counter("common_colors_http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "code")
+	requestDuration = registry.Histogram("common_colors_http_request_duration_seconds",
+		"HTTP request latency by route.", metrics.DefaultBuckets, "route")
+	stageDuration = registry.Histogram("common_colors_stage_duration_seconds",
+		"Duration of the pipeline stages: decode, resize (sampling), filter, cluster, rank and gradient.", metrics.DefaultBuckets, "stage")
+	inputBytes = registry.Histogram("common_colors_input_bytes",
+		"Size of the processed images by format.", metrics.SizeBuckets, "format")
+	cacheRequests = registry.Counter("common_colors_result_cache_requests_total",
+		"Upload result cache lookups by result: hit, miss or not_modified.", "result")
+	errorsTotal = registry.Counter("common_colors_errors_total",
+		"Errors returned to clients by code, including batch items and streams.", "code")
+)
+
+// statusRecorder keeps the status code of a response for the request metrics
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrument counts the requests of a route and measures their latency
+func instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		requestsTotal.Inc(route, methodLabel(r.Method), strconv.Itoa(rec.status))
+		requestDuration.Observe(time.Since(start).Seconds(), route)
+	})
+}
+
+// methodLabel keeps the label values of methods bounded, any token is a valid method for net/http
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodOptions, http.MethodHead:
+		return method
+	}
+
+	return "other"
+}
+
+// stageObserver records the pipeline metrics
+type stageObserver struct{}
+
+func (stageObserver) Input(format string, size int) {
+	inputBytes.Observe(float64(size), format)
+}
+
+func (stageObserver) Stage(name string, d time.Duration) {
+	stageDuration.Observe(d.Seconds(), name)
+}
+
+// observedHandler sets the stage observer of every request
+type observedHandler struct {
+	APIHandler
+}
+
+func (h observedHandler) ProcessImage(file io.Reader, imageType string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error) {
+	opts.Observer = stageObserver{}
+	return h.APIHandler.ProcessImage(file, imageType, config, opts)
+}
+
+func (h observedHandler) ProcessURL(ctx context.Context, url string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error) {
+	opts.Observer = stageObserver{}
+	return h.APIHandler.ProcessURL(ctx, url, config, opts)
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleReady fails while the server is starting or draining so no new requests are routed to it
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/simonmarton/common-colors/logging"
+)
+
+func TestMetrics(t *testing.T) {
+	s, err := New(&fakeHandler{}, Config{Logger: logging.Discard, DisableStatic: true, JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func() {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("image", "a.png")
+		fw.Write([]byte("metrics"))
+		mw.WriteField("config", "{}")
+		mw.Close()
+
+		r := httptest.NewRequest("POST", "/api/upload", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		s.Handler().ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	hits := cacheRequests.Value("hit")
+	before := requestsTotal.Value("/api/upload", "POST", "200")
+	upload()
+	upload()
+
+	if requestsTotal.Value("/api/upload", "POST", "200")-before != 2 {
+		t.Errorf("Expected 2 counted uploads")
+	}
+
+	if cacheRequests.Value("hit")-hits != 1 {
+		t.Errorf("Expected the second upload to hit the cache")
+	}
+
+	// Made up methods share one label value
+	others := requestsTotal.Value("/api/url", "other", "405")
+	s.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("FOO1", "/api/url", nil))
+	s.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("FOO2", "/api/url", nil))
+	if requestsTotal.Value("/api/url", "other", "405")-others != 2 || requestsTotal.Value("/api/url", "FOO1", "405") != 0 {
+		t.Errorf("Expected unknown methods to be counted as other")
+	}
+
+	s.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/upload", nil))
+	if errorsTotal.Value(CodeMissingField) == 0 {
+		t.Errorf("Expected the missing image to be counted")
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, name := range []string{"common_colors_http_requests_total{", "common_colors_http_request_duration_seconds_bucket{", "common_colors_errors_total{"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("Expected %s in the metrics", name)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	s, err := New(&fakeHandler{}, Config{Logger: logging.Discard, DisableStatic: true, JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != 200 {
+		t.Errorf("Expected healthy, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != 503 {
+		t.Errorf("Expected not ready before Run, got %d", w.Code)
+	}
+
+	s.ready.Store(true)
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != 200 {
+		t.Errorf("Expected ready, got %d", w.Code)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, "debug", "json")
+
+	var seen string
+	h := logRequests(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+		logging.FromContext(r.Context()).Debug("Handling")
+	}))
+
+	r := httptest.NewRequest("GET", "/api/upload", nil)
+	r.Header.Set("X-Request-ID", "trace-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if seen != "trace-1" || w.Header().Get("X-Request-ID") != "trace-1" {
+		t.Errorf("Expected the request ID of the client, got %s", seen)
+	}
+
+	if strings.Count(buf.String(), `"request_id":"trace-1"`) != 2 {
+		t.Errorf("Expected both records with the request ID, got %s", buf.String())
+	}
+
+	r = httptest.NewRequest("GET", "/api/upload", nil)
+	r.Header.Set("X-Request-ID", "bad\nid")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if id := w.Header().Get("X-Request-ID"); id == "" || strings.Contains(id, "\n") {
+		t.Errorf("Expected a generated request ID, got %q", id)
+	}
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/simonmarton/common-colors/jobs"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+// APIVersion of the /api/v1 routes, fields are only added within a major version
+const APIVersion = "1.0.0"
+
+// schemaDescriptions document the components and their fields, "Type" or "Type.jsonField"
+var schemaDescriptions = map[string]string{
+	"CommonColorsResp":                      "Common colors of an image, ordered by weight, the first one is the main color.",
+	"CommonColorsResp.gradient":             "Two hex colors for a gradient based on the main color.",
+	"CommonColorsResp.steps":                "Colors of the sampled, filtered and every clustering step, only set with the steps query parameter.",
+	"ColorResp.value":                       "Hex color.",
+	"ColorResp.hueDistance":                 "Hue distance from the main color, between 0 and 1.",
+	"ColorStepResp":                         "A color of a step with its weight, for visualization.",
+	"CalculatorConfig":                      "Parameters of the extraction, zero values use the defaults.",
+	"CalculatorConfig.transparencyTreshold": "Pixels with an alpha at or below it are dropped.",
+	"CalculatorConfig.iterationCount":       "Clustering iterations.",
+	"CalculatorConfig.distanceThreshold":    "Largest distance of colors merged in the last iteration.",
+	"CalculatorConfig.alphaWeighted":        "Weight pixels by their alpha instead of dropping the transparent ones.",
+	"CalculatorConfig.background":           "Hex color to composite semi-transparent pixels onto.",
+	"CalculatorConfig.pixelBudget":          "Number of pixels sampled, the aspect ratio is kept.",
+	"CalculatorConfig.seed":                 "Seed of the random sampling.",
+	"CalculatorConfig.backgroundWeight":     "Weight of the detected background pixels, 0 excludes them.",
+	"CalculatorConfig.centerSigma":          "Width of the center bias relative to the image size.",
+	"Selection":                             "Pixels used for the extraction, only the ones selected by every set field.",
+	"Selection.polygons":                    "A pixel is selected if its center is inside any of the polygons.",
+	"Job.progress":                          "Between 0 and 1.",
+	"Job.error":                             "Message of a failed job.",
+	"APIError.code":                         "Stable code for clients to check.",
+	"APIError.field":                        "Form field or JSON key of the request which caused the error.",
+	"BatchItem":                             "The result or the error of one image in a batch.",
+	"StreamEvent":                           "One line of an NDJSON stream, SSE streams have the event name in the event field and the data in the data field.",
+}
+
+// schemaEnums are the allowed values of string fields besides the ones of
+// CalculatorConfig, which come from pipeline.ConfigValues
+var schemaEnums = map[string][]string{
+	"Job.status":        {string(jobs.Queued), string(jobs.Running), string(jobs.Done), string(jobs.Failed), string(jobs.Canceled)},
+	"StreamEvent.event": {"step", "result", "item", "error", "done"},
+}
+
+// enumOf returns the allowed values of a field of a component
+func enumOf(name, field string) ([]string, bool) {
+	if name == "CalculatorConfig" {
+		values, ok := pipeline.ConfigValues[field]
+		return values, ok
+	}
+
+	values, ok := schemaEnums[name+"."+field]
+	return values, ok
+}
+
+// requestRequired are the required fields of request bodies, the fields of
+// responses are required unless they are omitted when empty
+var requestRequired = map[string][]string{
+	"CalculatorConfig": nil,
+	"Selection":        nil,
+	"URLReq":           {"url"},
+	"BatchReq":         {"urls"},
+	"JobReq":           {"url"},
+}
+
+// schemaGen generates the components of the OpenAPI document from the types of the responses,
+// so the document can't drift from them
+type schemaGen struct {
+	components map[string]interface{}
+}
+
+// ref adds the component of a struct and returns a reference to it
+func (g *schemaGen) ref(v interface{}) map[string]interface{} {
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct:
+		return g.schema(t.Elem())
+	case t.Kind() == reflect.Ptr:
+		s := g.schema(t.Elem())
+		s["nullable"] = true
+		return s
+	case t.Kind() == reflect.Struct:
+		name := componentName(t)
+		if _, ok := g.components[name]; !ok {
+			// Set before the fields so recursive types end
+			g.components[name] = nil
+			g.components[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Uint8:
+		return map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 255}
+	case t.Kind() == reflect.Int8:
+		return map[string]interface{}{"type": "integer", "minimum": -128, "maximum": 127}
+	case t.Kind() == reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	}
+
+	// Any JSON value
+	return map[string]interface{}{}
+}
+
+// componentName is the name of the type, jobs.Input is JobInput
+func componentName(t reflect.Type) string {
+	if t == reflect.TypeOf(jobs.Input{}) {
+		return "JobInput"
+	}
+
+	return t.Name()
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	name := componentName(t)
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		field, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if field == "-" || !f.IsExported() {
+			continue
+		}
+		if field == "" {
+			field = f.Name
+		}
+
+		s := g.schema(f.Type)
+		if description, ok := schemaDescriptions[name+"."+field]; ok {
+			s = withDescription(s, description)
+		}
+		if enum, ok := enumOf(name, field); ok {
+			s["enum"] = enum
+		}
+		properties[field] = s
+
+		if options != "omitempty" {
+			required = append(required, field)
+		}
+	}
+
+	if fields, ok := requestRequired[name]; ok {
+		required = fields
+	}
+
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	if description, ok := schemaDescriptions[name]; ok {
+		s["description"] = description
+	}
+
+	return s
+}
+
+// withDescription adds a description, references can't have siblings so they are wrapped
+func withDescription(s map[string]interface{}, description string) map[string]interface{} {
+	if _, ok := s["$ref"]; ok {
+		s = map[string]interface{}{"allOf": []interface{}{s}}
+	}
+	s["description"] = description
+
+	return s
+}
+
+// openAPI generates the OpenAPI 3 document of the /api/v1 routes
+func openAPI() map[string]interface{} {
+	g := &schemaGen{components: map[string]interface{}{}}
+
+	content := func(s map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"application/json": map[string]interface{}{"schema": s}}
+	}
+	response := func(description string, s map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"description": description, "content": content(s)}
+	}
+	streamed := func(description string, s map[string]interface{}) map[string]interface{} {
+		event := map[string]interface{}{"schema": g.ref(StreamEvent{})}
+		c := content(s)
+		c["application/x-ndjson"] = event
+		c["text/event-stream"] = event
+		return map[string]interface{}{"description": description, "content": c}
+	}
+	errorResponse := response("Error, see the code", g.ref(ErrorResp{}))
+
+	stepsParam := map[string]interface{}{
+		"name": "steps", "in": "query", "allowEmptyValue": true,
+		"description": "Include the colors of every step in the result.",
+		"schema":      map[string]interface{}{"type": "boolean"},
+	}
+	streamParam := map[string]interface{}{
+		"name": "stream", "in": "query",
+		"description": "Stream the steps and the result, also selected by the Accept header.",
+		"schema":      map[string]interface{}{"type": "string", "enum": []string{"ndjson", "sse"}},
+	}
+	jobIDParam := map[string]interface{}{
+		"name": "id", "in": "path", "required": true,
+		"schema": map[string]interface{}{"type": "string", "pattern": "^[0-9a-f]{32}$"},
+	}
+
+	uploadForm := map[string]interface{}{
+		"type":     "object",
+		"required": []string{"image", "config"},
+		"properties": map[string]interface{}{
+			"image":     map[string]interface{}{"type": "string", "format": "binary", "description": "PNG or JPEG image."},
+			"config":    withDescription(g.ref(models.CalculatorConfig{}), "JSON encoded."),
+			"selection": withDescription(g.ref(models.Selection{}), "JSON encoded."),
+			"mask":      map[string]interface{}{"type": "string", "format": "binary", "description": "Lighter pixels are weighted more, black or transparent ones are ignored."},
+		},
+	}
+	multipart := func(s map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"multipart/form-data": map[string]interface{}{"schema": s}}
+	}
+
+	batchForm := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"image":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "format": "binary"}},
+			"url":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "format": "uri"}},
+			"config":    withDescription(g.ref(models.CalculatorConfig{}), "JSON encoded."),
+			"selection": withDescription(g.ref(models.Selection{}), "JSON encoded, masks are not supported."),
+		},
+	}
+	batchBody := multipart(batchForm)
+	batchBody["application/json"] = map[string]interface{}{"schema": g.ref(BatchReq{})}
+
+	jobForm := map[string]interface{}{
+		"type":     "object",
+		"required": []string{"image"},
+		"properties": map[string]interface{}{
+			"image":       map[string]interface{}{"type": "string", "format": "binary"},
+			"config":      withDescription(g.ref(models.CalculatorConfig{}), "JSON encoded."),
+			"selection":   withDescription(g.ref(models.Selection{}), "JSON encoded, masks are not supported."),
+			"callbackUrl": map[string]interface{}{"type": "string", "format": "uri"},
+		},
+	}
+	jobBody := multipart(jobForm)
+	jobBody["application/json"] = map[string]interface{}{"schema": g.ref(JobReq{})}
+
+	paths := map[string]interface{}{
+		"/api/v1/upload": map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": "upload",
+				"summary":     "Common colors of an uploaded image",
+				"parameters":  []interface{}{stepsParam, streamParam},
+				"requestBody": map[string]interface{}{"required": true, "content": multipart(uploadForm)},
+				"responses": map[string]interface{}{
+					"200":     streamed("Result, cached by the ETag header", g.ref(CommonColorsResp{})),
+					"304":     map[string]interface{}{"description": "The result didn't change since the If-None-Match ETag"},
+					"default": errorResponse,
+				},
+			},
+		},
+		"/api/v1/url": map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": "url",
+				"summary":     "Common colors of an image URL",
+				"parameters":  []interface{}{stepsParam, streamParam},
+				"requestBody": map[string]interface{}{"required": true, "content": content(g.ref(URLReq{}))},
+				"responses": map[string]interface{}{
+					"200":     streamed("Result", g.ref(CommonColorsResp{})),
+					"default": errorResponse,
+				},
+			},
+		},
+		"/api/v1/batch": map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": "batch",
+				"summary":     "Common colors of many images, with a result or error per item",
+				"parameters":  []interface{}{streamParam},
+				"requestBody": map[string]interface{}{"required": true, "content": batchBody},
+				"responses": map[string]interface{}{
+					"200":     streamed("Results in the order of the inputs, streamed as they finish", g.ref(BatchResp{})),
+					"default": errorResponse,
+				},
+			},
+		},
+		"/api/v1/jobs": map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": "createJob",
+				"summary":     "Queue an image, the callback URL gets the finished job signed with X-Signature",
+				"requestBody": map[string]interface{}{"required": true, "content": jobBody},
+				"responses": map[string]interface{}{
+					"202":     response("Queued job, its URL is in the Location header", g.ref(jobs.Job{})),
+					"default": errorResponse,
+				},
+			},
+		},
+		"/api/v1/jobs/{id}": map[string]interface{}{
+			"parameters": []interface{}{jobIDParam},
+			"get": map[string]interface{}{
+				"operationId": "getJob",
+				"summary":     "Status, progress and result of a job",
+				"responses": map[string]interface{}{
+					"200":     response("Job", g.ref(jobs.Job{})),
+					"default": errorResponse,
+				},
+			},
+			"delete": map[string]interface{}{
+				"operationId": "deleteJob",
+				"summary":     "Cancel a job or delete a finished one",
+				"responses": map[string]interface{}{
+					"200":     response("Canceled job", g.ref(jobs.Job{})),
+					"default": errorResponse,
+				},
+			},
+		},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Common colors",
+			"version": APIVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{},
+			map[string]interface{}{"apiKey": []string{}},
+			map[string]interface{}{"bearer": []string{}},
+		},
+	}
+}
+
+// handleOpenAPI serves the OpenAPI document, generated once
+func handleOpenAPI() http.HandlerFunc {
+	doc, err := json.MarshalIndent(openAPI(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			methodNotAllowed(w, r, "GET, HEAD")
+			return
+		}
+
+		writeJSONBytes(w, http.StatusOK, doc)
+	}
+}
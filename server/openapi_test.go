@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/simonmarton/common-colors/jobs"
+	"github.com/simonmarton/common-colors/logging"
+	"github.com/simonmarton/common-colors/models"
+)
+
+type openAPIDoc struct {
+	OpenAPI    string                     `json:"openapi"`
+	Paths      map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	s, err := New(&fakeHandler{}, Config{Logger: logging.Discard, DisableStatic: true, JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+
+	var doc openAPIDoc
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || w.Code != 200 {
+		t.Fatalf("Expected the OpenAPI document, got %d %v", w.Code, err)
+	}
+
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("Expected OpenAPI 3, got %s", doc.OpenAPI)
+	}
+
+	for _, path := range []string{"/api/v1/upload", "/api/v1/url", "/api/v1/batch", "/api/v1/jobs", "/api/v1/jobs/{id}"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("Expected %s in the paths", path)
+		}
+	}
+
+	// The schemas have the same fields as the JSON of the responses
+	steps := [][]ColorStepResp{{{R: 1}}}
+	responses := map[string]interface{}{
+		"CommonColorsResp": CommonColorsResp{Colors: []ColorResp{{Value: "#fff"}}, StepsOfColors: steps},
+		"ColorResp":        ColorResp{},
+		"ColorStepResp":    ColorStepResp{},
+		"CalculatorConfig": models.CalculatorConfig{},
+		"Job":              jobs.Job{Result: &CommonColorsResp{}, CallbackURL: "http://a", Error: "e"},
+		"BatchItem":        BatchItem{Result: &CommonColorsResp{}, Error: &APIError{Field: "image"}},
+		"APIError":         APIError{Field: "image"},
+		"StreamEvent":      StreamEvent{},
+	}
+
+	for name, resp := range responses {
+		b, _ := json.Marshal(resp)
+		var fields map[string]interface{}
+		json.Unmarshal(b, &fields)
+
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("Expected %s in the schemas", name)
+			continue
+		}
+
+		if expected, got := sortedKeys(fields), sortedKeys(schema.Properties); !reflect.DeepEqual(expected, got) {
+			t.Errorf("Schema %s error, expected properties %v, got %v", name, expected, got)
+		}
+	}
+
+	if required := doc.Components.Schemas["CalculatorConfig"].Required; len(required) != 0 {
+		t.Errorf("Expected every config field to be optional, got %v", required)
+	}
+
+	// The form fields parseBatch reads
+	var batch struct {
+		Post struct {
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]json.RawMessage `json:"properties"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+		} `json:"post"`
+	}
+	json.Unmarshal(doc.Paths["/api/v1/batch"], &batch)
+	if got := sortedKeys(batch.Post.RequestBody.Content["multipart/form-data"].Schema.Properties); !reflect.DeepEqual(got, []string{"config", "image", "selection", "url"}) {
+		t.Errorf("Expected every field of the batch form, got %v", got)
+	}
+}
+
+func TestAPIAliases(t *testing.T) {
+	s, err := New(&fakeHandler{}, Config{Logger: logging.Discard, DisableStatic: true, JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/api/v1/jobs", "/api/jobs"} {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(`{"url": "http://a"}`)))
+
+		if w.Code != 202 || w.Header().Get("Location")[:len(path)] != path {
+			t.Errorf("Expected %s to queue a job, got %d %s", path, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// The unversioned routes keep the null steps of the old format, v1 leaves them out
+	expected := map[string]string{
+		"/api/v1/url": `{"colors":null,"gradient":["http://a"]}`,
+		"/api/url":    `{"colors":null,"gradient":["http://a"],"steps":null}`,
+	}
+	for path, body := range expected {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(`{"url": "http://a"}`)))
+
+		if w.Body.String() != body {
+			t.Errorf("Expected %s from %s, got %s", body, path, w.Body.String())
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -1,77 +1,661 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"image"
+	// Decoders for mask images
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"google.golang.org/grpc"
+
+	"github.com/simonmarton/common-colors/cache"
+	"github.com/simonmarton/common-colors/jobs"
+	"github.com/simonmarton/common-colors/logging"
 	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/pipeline"
+	"github.com/simonmarton/common-colors/public"
 )
 
 // CommonColorsResp format
-type CommonColorsResp struct {
-	Colors        []ColorResp        `json:"colors"`
-	Gradient      []string           `json:"gradient"`
-	StepsOfColors *[][]ColorStepResp `json:"steps"`
-}
+type CommonColorsResp = models.CommonColorsResp
 
 // ColorResp ...
-type ColorResp struct {
-	Weight      int     `json:"weight"`
-	Value       string  `json:"value"`
-	HueDistance float64 `json:"hueDistance"`
-}
+type ColorResp = models.ColorResp
 
 // ColorStepResp ...
-type ColorStepResp struct {
-	R      uint8 `json:"r"`
-	G      uint8 `json:"g"`
-	B      uint8 `json:"b"`
-	Weight int   `json:"weight"`
+type ColorStepResp = models.ColorStepResp
+
+// URLReq format
+type URLReq struct {
+	URL       string                  `json:"url"`
+	Config    models.CalculatorConfig `json:"config"`
+	Selection models.Selection        `json:"selection"`
 }
 
 // APIHandler interface
 type APIHandler interface {
 	// GetCommonColors(io.Reader) CommonColorsResp
-	ProcessImage(file io.Reader, imageType string, config models.CalculatorConfig, withSteps bool) (CommonColorsResp, error)
+	ProcessImage(file io.Reader, imageType string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error)
+	ProcessURL(ctx context.Context, url string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error)
+}
+
+const (
+	defaultAddr            = ":8080"
+	defaultReadTimeout     = 30 * time.Second
+	defaultWriteTimeout    = 5 * time.Minute
+	defaultIdleTimeout     = 2 * time.Minute
+	defaultShutdownTimeout = 30 * time.Second
+	defaultMaxUploadSize   = 32 << 20
+	defaultCacheDirSize    = 512 << 20
+)
+
+// Server serves the web pages and the API
+type Server struct {
+	config  Config
+	handler http.Handler
+	jobs    *jobs.Queue
+	process jobs.Processor
+	logger  *slog.Logger
+	ready   atomic.Bool
+	grpc    *grpc.Server
+}
+
+// New creates a Server, zero values of the config are replaced with defaults
+func New(h APIHandler, c Config) (*Server, error) {
+	if c.Addr == "" {
+		c.Addr = defaultAddr
+	}
+
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = defaultReadTimeout
+	}
+
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = defaultWriteTimeout
+	}
+
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = defaultIdleTimeout
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	if c.MaxUploadSize <= 0 {
+		c.MaxUploadSize = defaultMaxUploadSize
+	}
+
+	if c.MaxPixelBudget <= 0 {
+		c.MaxPixelBudget = pipeline.DefaultMaxPixelBudget
+	}
+
+	if c.CacheSize <= 0 {
+		c.CacheSize = defaultCacheSize
+	}
+
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = defaultCacheTTL
+	}
+
+	if c.CacheDirSize <= 0 {
+		c.CacheDirSize = defaultCacheDirSize
+	}
+
+	if c.BatchWorkers <= 0 {
+		c.BatchWorkers = runtime.NumCPU()
+	}
+
+	if c.CORSOrigins == "" {
+		c.CORSOrigins = defaultCORSOrigins
+	}
+
+	if c.CORSMethods == "" {
+		c.CORSMethods = defaultCORSMethods
+	}
+
+	if c.CORSHeaders == "" {
+		c.CORSHeaders = defaultCORSHeaders
+	}
+
+	if c.CORSMaxAge <= 0 {
+		c.CORSMaxAge = defaultCORSMaxAge
+	}
+
+	if c.Logger == nil {
+		logger, err := logging.New(os.Stderr, c.LogLevel, c.LogFormat)
+		if err != nil {
+			return nil, err
+		}
+		c.Logger = logger
+	}
+
+	cors, err := newCORS(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var resultCache cache.Cache = cache.NewMemory(c.CacheSize, c.CacheTTL)
+	if c.CacheDir != "" {
+		disk, err := cache.NewDisk(c.CacheDir, c.CacheDirSize, c.CacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		resultCache = cache.Tiered(resultCache, disk)
+	}
+
+	fetcher := newFetcher(c, resultCache)
+	if fh, ok := h.(FetchingHandler); ok {
+		h = fh.WithFetcher(fetcher)
+	}
+
+	jobsConfig := jobs.Config{
+		Workers:   c.JobWorkers,
+		Retention: c.JobRetention,
+		// Callback URLs get the same SSRF protection as image URLs
+		Client: fetcher.Client(),
+		Secret: c.WebhookSecret,
+		Logger: c.Logger,
+	}
+
+	if c.JobsDir != "" {
+		store, err := jobs.NewFileStore(c.JobsDir)
+		if err != nil {
+			return nil, err
+		}
+		jobsConfig.Store = store.WithLogger(c.Logger)
+	}
+
+	q, err := jobs.New(jobsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys *apiKeys
+	if c.APIKeysFile != "" {
+		keys, err = loadAPIKeys(c.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rate *rateLimiter
+	if c.RateLimit > 0 {
+		rate = newRateLimiter(c.RateLimit, c.RateBurst)
+	}
+
+	var concurrency *concurrencyLimiter
+	if c.MaxConcurrent > 0 {
+		concurrency = newConcurrencyLimiter(c.MaxConcurrent)
+	}
+
+	s := &Server{config: c, jobs: q, logger: c.Logger}
+	limits := pipeline.Limits{MaxPixels: c.MaxPixels, MaxFrames: c.MaxFrames, DecodeTimeout: c.DecodeTimeout, MaxPixelBudget: c.MaxPixelBudget}
+	h = limitedHandler{observedHandler{h}, limits}
+	s.process = jobProcessor(h, c.Logger)
+
+	mux := http.NewServeMux()
+
+	switch {
+	case c.DisableStatic:
+	case c.StaticDir != "":
+		mux.Handle("/", devStatic(c.StaticDir))
+	default:
+		static, err := newStatic(public.FS)
+		if err != nil {
+			return nil, err
+		}
+		mux.Handle("/", static)
+	}
+
+	api := func(route string, handler http.HandlerFunc) {
+		// With keys the limits are counted per key after authentication,
+		// and the rate per IP before it so guessing keys or signatures is limited too
+		var h http.Handler = recoverErrors(handler)
+		if rate != nil || concurrency != nil {
+			h = limitRequests(rate, concurrency, c.TrustProxy, h)
+		}
+		if keys != nil {
+			h = requireKey(keys, h)
+			if rate != nil {
+				h = limitRequests(rate, nil, c.TrustProxy, h)
+			}
+		}
+
+		mux.Handle(route, instrument(route, logRequests(c.Logger, cors.handle(http.MaxBytesHandler(h, c.MaxUploadSize)))))
+	}
+
+	// The unversioned routes are aliases of v1 for the clients which used them before versioning
+	for _, prefix := range []string{"/api/v1", "/api"} {
+		legacy := prefix == "/api"
+		api(prefix+"/upload", handleUpload(h, resultCache, limits, legacy))
+		api(prefix+"/url", handleURL(h, legacy))
+		api(prefix+"/batch", handleBatch(h, c.BatchWorkers))
+		api(prefix+"/jobs", handleJobs(q, prefix+"/jobs/"))
+		api(prefix+"/jobs/", handleJob(q, prefix+"/jobs/"))
+	}
+
+	// The document is public so clients can be generated before getting a key
+	mux.Handle("/api/v1/openapi.json", instrument("/api/v1/openapi.json", cors.handle(handleOpenAPI())))
+
+	if c.GRPCAddr != "" {
+		s.grpc, err = newGRPC(h, c, limits, keys, rate, concurrency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mux.Handle("/metrics", registry.Handler())
+	mux.HandleFunc("/healthz", handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+
+	s.handler = mux
+
+	return s, nil
+}
+
+// limitedHandler applies the image and sampling limits of the config to every request
+type limitedHandler struct {
+	APIHandler
+	limits pipeline.Limits
+}
+
+func (h limitedHandler) ProcessImage(file io.Reader, imageType string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error) {
+	opts.Limits = h.limits
+	return h.APIHandler.ProcessImage(file, imageType, h.limits.Apply(config), opts)
+}
+
+func (h limitedHandler) ProcessURL(ctx context.Context, url string, config models.CalculatorConfig, opts pipeline.Options) (CommonColorsResp, error) {
+	opts.Limits = h.limits
+	return h.APIHandler.ProcessURL(ctx, url, h.limits.Apply(config), opts)
+}
+
+// Handler serves every route of the server
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Run processes jobs and serves requests until the context is done, then waits
+// at most ShutdownTimeout for the running requests to finish
+func (s *Server) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:         s.config.Addr,
+		Handler:      s.handler,
+		ReadTimeout:  s.config.ReadTimeout,
+		WriteTimeout: s.config.WriteTimeout,
+		IdleTimeout:  s.config.IdleTimeout,
+	}
+
+	// The jobs stop before the context only if their store can't be read, the server doesn't
+	// run without them as it would keep accepting jobs nobody processes
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan error, 1)
+	go func() {
+		jobsDone <- s.jobs.Run(jobsCtx, s.process)
+	}()
+
+	ln, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		stopJobs()
+		<-jobsDone
+		return err
+	}
+
+	var grpcLn net.Listener
+	if s.grpc != nil {
+		grpcLn, err = net.Listen("tcp", s.config.GRPCAddr)
+		if err != nil {
+			ln.Close()
+			stopJobs()
+			<-jobsDone
+			return err
+		}
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		s.logger.Info("Listening", "addr", ln.Addr().String(), "tls", s.config.TLSCert != "")
+		if s.config.TLSCert != "" {
+			errs <- srv.ServeTLS(ln, s.config.TLSCert, s.config.TLSKey)
+		} else {
+			errs <- srv.Serve(ln)
+		}
+	}()
+
+	if grpcLn != nil {
+		go func() {
+			s.logger.Info("Listening for gRPC", "addr", grpcLn.Addr().String(), "tls", s.config.TLSCert != "")
+			errs <- s.grpc.Serve(grpcLn)
+		}()
+	}
+	s.ready.Store(true)
+
+	select {
+	case err = <-errs:
+		srv.Close()
+		if s.grpc != nil {
+			s.grpc.Stop()
+		}
+	case err = <-jobsDone:
+		s.ready.Store(false)
+		s.logger.Error("Processing jobs failed", "error", err)
+		srv.Close()
+		if s.grpc != nil {
+			s.grpc.Stop()
+		}
+		stopJobs()
+
+		return fmt.Errorf("Processing jobs: %w", err)
+	case <-ctx.Done():
+		s.logger.Info("Shutting down", "timeout", s.config.ShutdownTimeout)
+		s.ready.Store(false)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+		defer cancel()
+
+		grpcStopped := make(chan struct{})
+		go func() {
+			if s.grpc != nil {
+				s.stopGRPC(shutdownCtx)
+			}
+			close(grpcStopped)
+		}()
+
+		err = srv.Shutdown(shutdownCtx)
+		<-grpcStopped
+	}
+
+	// Running jobs are resumed after the next start
+	stopJobs()
+	<-jobsDone
+
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
 }
 
-// Initialize a new web server
+// stopGRPC waits for the running calls until the context is done, then cancels them
+func (s *Server) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
+
+// Initialize a new web server with the default config, runs until SIGTERM or interrupt
 func Initialize(h APIHandler) {
-	http.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("public/"))))
+	s, err := New(h, Config{})
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if err := s.Run(ctx); err != nil {
+		panic(err)
+	}
+}
 
-	http.HandleFunc("/api/upload", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("handle api upload")
+// legacyResp is the result as it was before versioning, steps is null unless they were requested
+type legacyResp struct {
+	CommonColorsResp
+	StepsOfColors *[][]ColorStepResp `json:"steps"`
+}
+
+// resultResp is the result in the v1 format, or in the legacy one for the unversioned routes
+func resultResp(colors CommonColorsResp, legacy bool) interface{} {
+	if !legacy {
+		return colors
+	}
+
+	resp := legacyResp{CommonColorsResp: colors}
+	if colors.StepsOfColors != nil {
+		resp.StepsOfColors = &colors.StepsOfColors
+	}
+
+	return resp
+}
+
+func handleUpload(h APIHandler, resultCache cache.Cache, limits pipeline.Limits, legacy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		file, header, err := r.FormFile("image")
 		if err != nil {
-			panic(err)
+			writeError(w, r, fieldError("image", err))
+			return
+		}
+
+		config, err := parseConfig(r.FormValue("config"))
+		if err != nil {
+			writeError(w, r, err)
+			return
 		}
 
-		var config models.CalculatorConfig
-		err = json.Unmarshal([]byte(r.FormValue("config")), &config)
+		selection, maskSum, err := parseSelection(r, limits)
 		if err != nil {
-			panic(err)
+			writeError(w, r, err)
+			return
 		}
 
 		_, withSteps := r.URL.Query()["steps"]
 
-		colors, err := h.ProcessImage(file, header.Header.Get("Content-Type"), config, withSteps)
+		if s := newStream(w, r); s != nil {
+			opts := s.streamSteps(requestOptions(r, selection, false))
+			s.sendResult(h.ProcessImage(file, header.Header.Get("Content-Type"), config, opts))
+			return
+		}
+
+		body, err := io.ReadAll(file)
 		if err != nil {
-			panic(err)
+			writeError(w, r, fieldError("image", err))
+			return
+		}
+
+		etag := resultETag(body, maskSum, config, selection, withSteps)
+		w.Header().Set("ETag", etag)
+
+		// The formats are cached separately
+		cacheKey := etag
+		if legacy {
+			cacheKey = "legacy:" + etag
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		resp, err := json.Marshal(colors)
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			cacheRequests.Inc("not_modified")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if resultCache != nil {
+			if resp, ok := resultCache.Get(cacheKey); ok {
+				cacheRequests.Inc("hit")
+				writeJSONBytes(w, http.StatusOK, resp)
+				return
+			}
+			cacheRequests.Inc("miss")
+		}
+
+		colors, err := h.ProcessImage(bytes.NewReader(body), header.Header.Get("Content-Type"), config, requestOptions(r, selection, withSteps))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 
+		resp, err := json.Marshal(resultResp(colors, legacy))
 		if err != nil {
-			panic(err)
+			writeError(w, r, err)
+			return
 		}
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Write(resp)
-	})
+		if resultCache != nil {
+			resultCache.Set(cacheKey, resp)
+		}
+
+		writeJSONBytes(w, http.StatusOK, resp)
+	}
+}
+
+func handleURL(h APIHandler, legacy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+
+		var req URLReq
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeError(w, r, fieldError("body", err))
+			return
+		}
+
+		if req.URL == "" {
+			writeError(w, r, missingField("url"))
+			return
+		}
+
+		if err := checkConfig(req.Config); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if err := checkSelection(req.Selection); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if s := newStream(w, r); s != nil {
+			opts := s.streamSteps(requestOptions(r, req.Selection, false))
+			s.sendResult(h.ProcessURL(r.Context(), req.URL, req.Config, opts))
+			return
+		}
+
+		_, withSteps := r.URL.Query()["steps"]
+
+		colors, err := h.ProcessURL(r.Context(), req.URL, req.Config, requestOptions(r, req.Selection, withSteps))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, resultResp(colors, legacy))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, v interface{}) {
+	resp, err := json.Marshal(v)
+
+	if err != nil {
+		panic(err)
+	}
+
+	writeJSONBytes(w, status, resp)
+}
+
+func writeJSONBytes(w http.ResponseWriter, status int, resp []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// parseConfig reads the required config JSON of a form
+func parseConfig(v string) (config models.CalculatorConfig, err error) {
+	if v == "" {
+		return config, missingField("config")
+	}
+
+	if err = json.Unmarshal([]byte(v), &config); err != nil {
+		return config, fieldError("config", err)
+	}
+
+	return config, checkConfig(config)
+}
+
+// checkConfig rejects values of a config the pipeline doesn't support before any work starts
+func checkConfig(config models.CalculatorConfig) error {
+	if err := pipeline.Validate(config); err != nil {
+		return fieldError("config", err)
+	}
+
+	return nil
+}
+
+// checkSelection rejects selections over the limits of the pipeline before any work starts
+func checkSelection(selection models.Selection) error {
+	if err := pipeline.ValidateSelection(selection); err != nil {
+		return fieldError("selection", err)
+	}
+
+	return nil
+}
+
+// parseSelection reads the optional selection JSON and mask image of an upload request,
+// maskSum is the hash of the mask file
+func parseSelection(r *http.Request, limits pipeline.Limits) (selection models.Selection, maskSum string, err error) {
+	if v := r.FormValue("selection"); v != "" {
+		err = json.Unmarshal([]byte(v), &selection)
+		if err != nil {
+			return models.Selection{}, "", fieldError("selection", err)
+		}
+
+		if err = checkSelection(selection); err != nil {
+			return models.Selection{}, "", err
+		}
+	}
+
+	mask, _, err := r.FormFile("mask")
+	if err == http.ErrMissingFile {
+		return selection, "", nil
+	}
+	if err != nil {
+		return models.Selection{}, "", fieldError("mask", err)
+	}
+	defer mask.Close()
+
+	data, err := io.ReadAll(mask)
+	if err != nil {
+		return models.Selection{}, "", fieldError("mask", err)
+	}
+
+	if err := limits.Check(data); err != nil {
+		return models.Selection{}, "", fieldError("mask", err)
+	}
+
+	selection.Mask, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return models.Selection{}, "", fieldError("mask", &pipeline.DecodeError{Err: err})
+	}
+
+	sum := sha256.Sum256(data)
 
-	fmt.Println("Ready on http://localhost:8080")
-	http.ListenAndServe(":8080", nil)
+	return selection, hex.EncodeToString(sum[:]), nil
 }
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// hashLength is the length of the ?v= version of asset URLs
+const hashLength = 12
+
+// localRef matches the local script, style and image references of the pages
+var localRef = regexp.MustCompile(`(src|href)="(/[^"?#]+)"`)
+
+type asset struct {
+	data []byte
+	hash string
+}
+
+// staticHandler serves files from memory with ETags, references in the HTML pages get a
+// ?v=<hash> suffix so the browser can keep them until they change
+type staticHandler struct {
+	assets map[string]asset
+}
+
+// newStatic reads every file of fsys into memory
+func newStatic(fsys fs.FS) (*staticHandler, error) {
+	h := &staticHandler{assets: map[string]asset{}}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		h.assets[name] = newAsset(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// After every other file has its hash
+	for name, a := range h.assets {
+		if path.Ext(name) == ".html" {
+			h.assets[name] = newAsset(h.versionRefs(a.data))
+		}
+	}
+
+	return h, nil
+}
+
+func newAsset(data []byte) asset {
+	sum := sha256.Sum256(data)
+	return asset{data: data, hash: hex.EncodeToString(sum[:])}
+}
+
+// versionRefs appends the hash of the referenced file to every local reference of a page
+func (h *staticHandler) versionRefs(page []byte) []byte {
+	return localRef.ReplaceAllFunc(page, func(ref []byte) []byte {
+		m := localRef.FindSubmatch(ref)
+		a, ok := h.assets[strings.TrimPrefix(string(m[2]), "/")]
+		if !ok {
+			return ref
+		}
+
+		return []byte(string(m[1]) + `="` + string(m[2]) + "?v=" + a.hash[:hashLength] + `"`)
+	})
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	a, ok := h.assets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if v := r.URL.Query().Get("v"); v != "" && v == a.hash[:hashLength] {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", `"`+a.hash+`"`)
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(a.data))
+}
+
+// devStatic serves a directory from disk without caching, for editing the pages
+func devStatic(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/simonmarton/common-colors/logging"
+)
+
+func TestStatic(t *testing.T) {
+	h, err := newStatic(fstest.MapFS{
+		"index.html":   {Data: []byte(`<script src="/js/app.js"></script><use href="#icon" />`)},
+		"js/app.js":    {Data: []byte(`console.log(1)`)},
+		"js/other.txt": {Data: []byte(`other`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	body := w.Body.String()
+	version := h.assets["js/app.js"].hash[:hashLength]
+	if !strings.Contains(body, `src="/js/app.js?v=`+version+`"`) || !strings.Contains(body, `href="#icon"`) {
+		t.Errorf("Expected versioned script reference, got %s", body)
+	}
+
+	if w.Header().Get("Cache-Control") != "no-cache" || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("Expected revalidated HTML, got %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/js/app.js?v="+version, nil))
+	if !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("Expected versioned asset to be cached, got %s", w.Header().Get("Cache-Control"))
+	}
+
+	r := httptest.NewRequest("GET", "/js/app.js", nil)
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != 304 {
+		t.Errorf("Expected 304 for matching ETag, got %d", w.Code)
+	}
+
+	for _, p := range []string{"/missing.js", "/js/"} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		if w.Code != 404 {
+			t.Errorf("Expected 404 for %s, got %d", p, w.Code)
+		}
+	}
+}
+
+func TestEmbeddedPages(t *testing.T) {
+	s, err := New(&fakeHandler{}, Config{Logger: logging.Discard, JobsDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"/", "/chart.html", "/js/common.js", "/js/lib/three.min.js"} {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		if w.Code != 200 {
+			t.Errorf("Expected embedded %s, got %d", p, w.Code)
+		}
+	}
+}
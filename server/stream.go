@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+// stream writes events as newline delimited JSON or Server-Sent Events and flushes each of them
+type stream struct {
+	w   http.ResponseWriter
+	sse bool
+}
+
+// StreamEvent is a line of an NDJSON stream, SSE sends the name in the event field
+type StreamEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// newStream returns nil if the request didn't ask for streaming with ?stream=ndjson|sse or the Accept header
+func newStream(w http.ResponseWriter, r *http.Request) *stream {
+	format := r.URL.Query().Get("stream")
+	if format == "" {
+		accept := r.Header.Get("Accept")
+		switch {
+		case strings.Contains(accept, "text/event-stream"):
+			format = "sse"
+		case strings.Contains(accept, "application/x-ndjson"):
+			format = "ndjson"
+		}
+	}
+
+	s := &stream{w: w}
+	switch format {
+	case "sse":
+		s.sse = true
+		w.Header().Set("Content-Type", "text/event-stream")
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		return nil
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	return s
+}
+
+func (s *stream) send(event string, data interface{}) {
+	if s.sse {
+		b, err := json.Marshal(data)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, b)
+	} else {
+		b, err := json.Marshal(StreamEvent{Event: event, Data: data})
+		if err != nil {
+			panic(err)
+		}
+		s.w.Write(append(b, '\n'))
+	}
+
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// sendResult ends the stream with the result or the error
+func (s *stream) sendResult(result CommonColorsResp, err error) {
+	if err != nil {
+		apiErr := toAPIError(err)
+		errorsTotal.Inc(apiErr.Code)
+		s.send("error", apiErr)
+		return
+	}
+
+	s.send("result", result)
+}
+
+// streamSteps sets up the options to send every step of the calculation as it completes
+func (s *stream) streamSteps(opts pipeline.Options) pipeline.Options {
+	opts.OnStep = func(step []ColorStepResp) {
+		s.send("step", step)
+	}
+	// The steps were already sent
+	opts.WithSteps = false
+
+	return opts
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/simonmarton/common-colors/pipeline"
+)
+
+func TestBatchNDJSON(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/batch?stream=ndjson", bytes.NewBufferString(`{"urls": ["http://a", "http://b"]}`))
+	w := httptest.NewRecorder()
+	handleBatch(&fakeHandler{}, 1)(w, r)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON content type, got %s", ct)
+	}
+
+	var events []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var e struct {
+			Event string
+			Data  json.RawMessage
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e.Event)
+	}
+
+	if strings.Join(events, ",") != "item,item,done" {
+		t.Errorf("Expected two items and done, got %v", events)
+	}
+}
+
+func TestUploadSSE(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("image", "a.png")
+	fw.Write([]byte("a"))
+	mw.WriteField("config", `{}`)
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/api/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+
+	handleUpload(&fakeHandler{}, nil, pipeline.Limits{}, false)(w, r)
+
+	expected := "event: step\ndata: [{\"r\":1,\"g\":0,\"b\":0,\"weight\":1}]\n\n" +
+		"event: result\ndata: {\"colors\":null,\"gradient\":[\"a\"]}\n\n"
+	if w.Body.String() != expected {
+		t.Errorf("Unexpected SSE body %q", w.Body.String())
+	}
+}
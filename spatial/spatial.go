@@ -0,0 +1,180 @@
+package spatial
+
+import (
+	"image"
+	"math"
+
+	"github.com/simonmarton/common-colors/color"
+	"github.com/simonmarton/common-colors/models"
+	"github.com/simonmarton/common-colors/sampler"
+)
+
+const defaultCenterSigma float64 = .5
+
+// Saliency is calculated on a downscaled grid of at most this many cells
+const saliencyBudget int = 64 * 64
+
+// New creates per pixel weights based on their position in the image,
+// nil is returned if spatial weighting is turned off
+func New(img image.Image, c models.CalculatorConfig) sampler.Mask {
+	if c.CenterSigma <= 0 {
+		c.CenterSigma = defaultCenterSigma
+	}
+
+	switch c.SpatialWeighting {
+	case "center":
+		return centerWeights{bounds: img.Bounds(), sigma: c.CenterSigma}
+	case "edge":
+		return edgeWeights{bounds: img.Bounds()}
+	case "saliency":
+		return newSaliency(img)
+	default:
+		return nil
+	}
+}
+
+// centerWeights is a Gaussian centered on the image,
+// sigma is relative to the half width and height of the image
+type centerWeights struct {
+	bounds image.Rectangle
+	sigma  float64
+}
+
+func (w centerWeights) Bounds() image.Rectangle {
+	return w.bounds
+}
+
+func (w centerWeights) Coverage(x, y int) float64 {
+	dx, dy := relativeToCenter(w.bounds, x, y)
+
+	return math.Exp(-(dx*dx + dy*dy) / (2 * w.sigma * w.sigma))
+}
+
+// edgeWeights grow linearly from 0 at the edges to 1 in the middle of the image
+type edgeWeights struct {
+	bounds image.Rectangle
+}
+
+func (w edgeWeights) Bounds() image.Rectangle {
+	return w.bounds
+}
+
+func (w edgeWeights) Coverage(x, y int) float64 {
+	dx, dy := relativeToCenter(w.bounds, x, y)
+
+	return math.Max(0, 1-math.Max(math.Abs(dx), math.Abs(dy)))
+}
+
+// relativeToCenter maps the center of a pixel into -1, 1 where 0 is the center of the image
+func relativeToCenter(b image.Rectangle, x, y int) (float64, float64) {
+	halfW, halfH := float64(b.Dx())/2, float64(b.Dy())/2
+
+	return (float64(x-b.Min.X) + .5 - halfW) / halfW, (float64(y-b.Min.Y) + .5 - halfH) / halfH
+}
+
+// saliency is a frequency-tuned saliency map, https://infoscience.epfl.ch/record/135217
+// the saliency of a pixel is its distance in Lab space from the mean color of the image
+// after a slight blur, normalized to 0-1
+type saliency struct {
+	bounds        image.Rectangle
+	width, height int
+	values        []float64
+}
+
+func newSaliency(img image.Image) sampler.Mask {
+	b := img.Bounds()
+	if b.Empty() {
+		return nil
+	}
+
+	// Work on a coarse grid, one cell covers step x step pixels
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > saliencyBudget {
+		step++
+	}
+	width, height := max(1, b.Dx()/step), max(1, b.Dy()/step)
+
+	lab := make([][3]float64, width*height)
+	var mean [3]float64
+	for cx := 0; cx < width; cx++ {
+		for cy := 0; cy < height; cy++ {
+			c := color.NewFromRGBA(img.At(b.Min.X+cx*step+step/2, b.Min.Y+cy*step+step/2))
+			l, a, bb := c.ToLab()
+
+			lab[cy*width+cx] = [3]float64{l, a, bb}
+			mean[0] += l
+			mean[1] += a
+			mean[2] += bb
+		}
+	}
+
+	for i := range mean {
+		mean[i] /= float64(len(lab))
+	}
+
+	blurred := blur(lab, width, height)
+
+	s := &saliency{bounds: b, width: width, height: height, values: make([]float64, len(lab))}
+	maxValue := 0.
+	for i, v := range blurred {
+		s.values[i] = math.Sqrt(
+			math.Pow(v[0]-mean[0], 2) +
+				math.Pow(v[1]-mean[1], 2) +
+				math.Pow(v[2]-mean[2], 2),
+		)
+		maxValue = math.Max(maxValue, s.values[i])
+	}
+
+	// Uniform image, nothing stands out
+	if maxValue == 0 {
+		return nil
+	}
+
+	for i := range s.values {
+		s.values[i] /= maxValue
+	}
+
+	return s
+}
+
+// blur with a 3x3 binomial kernel, edges are clamped
+func blur(values [][3]float64, width, height int) [][3]float64 {
+	kernel := [3]float64{1, 2, 1}
+	result := make([][3]float64, len(values))
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			var sum [3]float64
+			for kx := -1; kx <= 1; kx++ {
+				for ky := -1; ky <= 1; ky++ {
+					nx := min(max(x+kx, 0), width-1)
+					ny := min(max(y+ky, 0), height-1)
+					k := kernel[kx+1] * kernel[ky+1] / 16
+
+					for i, v := range values[ny*width+nx] {
+						sum[i] += v * k
+					}
+				}
+			}
+
+			result[y*width+x] = sum
+		}
+	}
+
+	return result
+}
+
+func (s *saliency) Bounds() image.Rectangle {
+	return s.bounds
+}
+
+func (s *saliency) Coverage(x, y int) float64 {
+	if !image.Pt(x, y).In(s.bounds) {
+		return 0
+	}
+
+	cx := min((x-s.bounds.Min.X)*s.width/s.bounds.Dx(), s.width-1)
+	cy := min((y-s.bounds.Min.Y)*s.height/s.bounds.Dy(), s.height-1)
+
+	return s.values[cy*s.width+cx]
+}
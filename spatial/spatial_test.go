@@ -0,0 +1,82 @@
+package spatial
+
+import (
+	"image"
+	imagecolor "image/color"
+	"math"
+	"testing"
+
+	"github.com/simonmarton/common-colors/models"
+)
+
+func TestNewDisabled(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+
+	if New(img, models.CalculatorConfig{}) != nil {
+		t.Errorf("Expected no weights without spatial weighting")
+	}
+}
+
+func TestCenterWeights(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	w := New(img, models.CalculatorConfig{SpatialWeighting: "center"})
+
+	center := w.Coverage(50, 50)
+	if math.Abs(center-1) > .001 {
+		t.Errorf("Expected center weight 1, got %.4f", center)
+	}
+
+	// One sigma away from the center horizontally
+	if c := w.Coverage(75, 50); math.Abs(c-math.Exp(-.5)) > .02 {
+		t.Errorf("Expected weight %.4f, got %.4f", math.Exp(-.5), c)
+	}
+
+	if w.Coverage(0, 0) >= w.Coverage(25, 25) {
+		t.Errorf("Expected corner weight to be lower than closer to the center")
+	}
+}
+
+func TestEdgeWeights(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	w := New(img, models.CalculatorConfig{SpatialWeighting: "edge"})
+
+	if c := w.Coverage(0, 25); c > .02 {
+		t.Errorf("Expected weight close to 0 at the edge, got %.4f", c)
+	}
+
+	if c := w.Coverage(50, 25); c < .98 {
+		t.Errorf("Expected weight close to 1 in the middle, got %.4f", c)
+	}
+}
+
+func TestSaliency(t *testing.T) {
+	// Blue sky with a small red subject
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 40; y++ {
+			c := imagecolor.NRGBA{R: 100, G: 160, B: 230, A: 255}
+			if x >= 25 && x < 35 && y >= 25 && y < 35 {
+				c = imagecolor.NRGBA{R: 220, G: 30, B: 30, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	w := New(img, models.CalculatorConfig{SpatialWeighting: "saliency"})
+	if w == nil {
+		t.Fatalf("Expected saliency map")
+	}
+
+	subject, sky := w.Coverage(30, 30), w.Coverage(5, 5)
+	if subject < .9 || sky > .2 {
+		t.Errorf("Expected the subject to be salient, got subject %.4f, sky %.4f", subject, sky)
+	}
+}
+
+func TestSaliencyUniform(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+
+	if newSaliency(img) != nil {
+		t.Errorf("Expected no saliency map for a uniform image")
+	}
+}